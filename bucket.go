@@ -49,6 +49,36 @@ func (b *Bucket) Group(relativePath string, handlers ...gin.HandlerFunc) *gin.Ro
 	return b.routerGroup.Group(relativePath, handlers...)
 }
 
+// Handle register a route with name in the bucket, the name can be used to build url by URLFor
+func (b *Bucket) Handle(name, method, relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return Handle(b.routerGroup, name, method, relativePath, handlers...)
+}
+
+// GET register a GET route with name in the bucket
+func (b *Bucket) GET(name, relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return GET(b.routerGroup, name, relativePath, handlers...)
+}
+
+// POST register a POST route with name in the bucket
+func (b *Bucket) POST(name, relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return POST(b.routerGroup, name, relativePath, handlers...)
+}
+
+// PUT register a PUT route with name in the bucket
+func (b *Bucket) PUT(name, relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return PUT(b.routerGroup, name, relativePath, handlers...)
+}
+
+// PATCH register a PATCH route with name in the bucket
+func (b *Bucket) PATCH(name, relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return PATCH(b.routerGroup, name, relativePath, handlers...)
+}
+
+// DELETE register a DELETE route with name in the bucket
+func (b *Bucket) DELETE(name, relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return DELETE(b.routerGroup, name, relativePath, handlers...)
+}
+
 func (b *Bucket) UseMiddlewares(ms ...gin.HandlerFunc) {
 	if len(ms) == 0 {
 		return
@@ -0,0 +1,417 @@
+package ginx
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/whencome/ginx/log"
+	"github.com/whencome/ginx/validator"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultEnvPrefix prefix of environment variables overlaying the config, e.g. GINX_PORT
+const defaultEnvPrefix = "GINX"
+
+// Config settings of ginx, it's loaded by LoadConfig:
+//
+//	server:
+//	  port: 8080
+//	  read_timeout: 30s
+//	view:
+//	  tpl_dir: views
+//	  layout: layouts/main
+//	log:
+//	  level: info
+//	validator:
+//	  show_full_error: true
+type Config struct {
+	Server    ServerOptions   `json:"server" yaml:"server" toml:"server"`
+	View      ViewConfig      `json:"view" yaml:"view" toml:"view"`
+	Log       LogConfig       `json:"log" yaml:"log" toml:"log"`
+	Validator ValidatorConfig `json:"validator" yaml:"validator" toml:"validator"`
+}
+
+// ViewConfig settings of view, use Options to create a view: ginx.NewView(cfg.View.Options()...)
+type ViewConfig struct {
+	TplDir         string         `json:"tpl_dir" yaml:"tpl_dir" toml:"tpl_dir"`                         // template directory
+	TplFiles       []string       `json:"tpl_files" yaml:"tpl_files" toml:"tpl_files"`                   // common template files
+	TplExtension   string         `json:"tpl_extension" yaml:"tpl_extension" toml:"tpl_extension"`       // template file extension
+	Layout         string         `json:"layout" yaml:"layout" toml:"layout"`                            // default layout of pages
+	PartialsDir    string         `json:"partials_dir" yaml:"partials_dir" toml:"partials_dir"`          // directory of partial templates
+	Locale         string         `json:"locale" yaml:"locale" toml:"locale"`                            // locale of formatting functions
+	DevMode        *bool          `json:"dev_mode" yaml:"dev_mode" toml:"dev_mode"`                      // watch template changes, follows gin mode if not set
+	ReloadInterval time.Duration  `json:"reload_interval" yaml:"reload_interval" toml:"reload_interval"` // interval to check template changes
+	Gzip           bool           `json:"gzip" yaml:"gzip" toml:"gzip"`                                  // compress rendered output
+	GzipLevel      int            `json:"gzip_level" yaml:"gzip_level" toml:"gzip_level"`                // gzip compression level
+	ErrorTemplates map[int]string `json:"error_templates" yaml:"error_templates" toml:"error_templates"` // error templates by status code, 0 for all
+}
+
+// LogConfig settings of log
+type LogConfig struct {
+	Level string `json:"level" yaml:"level" toml:"level" binding:"omitempty,oneof=debug info error" label:"log.level"` // debug, info or error
+}
+
+// ValidatorConfig settings of validator
+type ValidatorConfig struct {
+	ShowFullError bool   `json:"show_full_error" yaml:"show_full_error" toml:"show_full_error"` // show all errors instead of the first one
+	ErrSeparator  string `json:"err_separator" yaml:"err_separator" toml:"err_separator"`       // separator of errors
+}
+
+// DefaultConfig create the default config
+func DefaultConfig() *Config {
+	return &Config{
+		Server: *DefaultServerOptions(),
+		View: ViewConfig{
+			TplDir:       "view",
+			TplExtension: ".html",
+		},
+		Log: LogConfig{
+			Level: "info",
+		},
+		Validator: ValidatorConfig{
+			ErrSeparator: "\n",
+		},
+	}
+}
+
+// Options get the view options of config
+func (c *ViewConfig) Options() []ViewOption {
+	opts := make([]ViewOption, 0)
+	if c.TplDir != "" {
+		opts = append(opts, WithTplDir(c.TplDir))
+	}
+	if len(c.TplFiles) > 0 {
+		opts = append(opts, WithTplFiles(c.TplFiles...))
+	}
+	if c.TplExtension != "" {
+		opts = append(opts, WithTplExtension(c.TplExtension))
+	}
+	if c.Layout != "" {
+		opts = append(opts, WithLayout(c.Layout))
+	}
+	if c.PartialsDir != "" {
+		opts = append(opts, WithPartialsDir(c.PartialsDir))
+	}
+	if c.Locale != "" {
+		opts = append(opts, WithLocale(c.Locale))
+	}
+	if c.DevMode != nil {
+		opts = append(opts, WithDevMode(*c.DevMode))
+	}
+	if c.ReloadInterval > 0 {
+		opts = append(opts, WithReloadInterval(c.ReloadInterval))
+	}
+	if c.Gzip {
+		opts = append(opts, WithGzip(c.GzipLevel))
+	}
+	for code, tpl := range c.ErrorTemplates {
+		opts = append(opts, WithErrorTemplate(code, tpl))
+	}
+	return opts
+}
+
+// Apply apply the log and validator settings globally
+func (c *Config) Apply() {
+	switch strings.ToLower(c.Log.Level) {
+	case "debug":
+		log.SetLogLevel(log.LevelDebug)
+	case "error":
+		log.SetLogLevel(log.LevelError)
+	default:
+		log.SetLogLevel(log.LevelInfo)
+	}
+	validator.ShowFullError(c.Validator.ShowFullError)
+	validator.SetErrSeparator(c.Validator.ErrSeparator)
+}
+
+// configLoader options of loading config
+type configLoader struct {
+	envPrefix string
+	flags     *flag.FlagSet
+}
+
+// ConfigOption set options of loading config
+type ConfigOption func(l *configLoader)
+
+// WithConfigEnvPrefix set the prefix of environment variables, "GINX" by default, empty disables the env overlay
+func WithConfigEnvPrefix(prefix string) ConfigOption {
+	return func(l *configLoader) {
+		l.envPrefix = prefix
+	}
+}
+
+// WithConfigFlags overlay the flags set in fs, flag.CommandLine is used by default once parsed
+func WithConfigFlags(fs *flag.FlagSet) ConfigOption {
+	return func(l *configLoader) {
+		l.flags = fs
+	}
+}
+
+// LoadConfig load config from a JSON, YAML or TOML file by extension, the path can be empty to load defaults only.
+// Settings are overlaid in order: defaults, the file, environment variables, command line flags. Environment
+// variables are named by the prefix and the keys, server settings don't have the section name, e.g.
+// GINX_PORT, GINX_READ_TIMEOUT, GINX_VIEW_TPL_DIR, GINX_LOG_LEVEL. Flags are named by the keys joined with ".",
+// e.g. -port, -view.tpl_dir, see RegisterConfigFlags. Durations must be written with
+// units such as "30s" (bare numbers other than 0 are rejected), lists as "a,b".
+// The config is validated after loaded.
+func LoadConfig(path string, opts ...ConfigOption) (*Config, error) {
+	l := &configLoader{envPrefix: defaultEnvPrefix}
+	if flag.Parsed() {
+		l.flags = flag.CommandLine
+	}
+	for _, o := range opts {
+		o(l)
+	}
+	data := make(map[string]interface{})
+	if path != "" {
+		var err error
+		if data, err = readConfigFile(path); err != nil {
+			return nil, err
+		}
+	}
+	keys := configKeys(reflect.TypeOf(Config{}), nil)
+	// non-string settings may be written as strings in files, e.g. read_timeout: 30s, unix_socket_mode: "0660"
+	for _, k := range keys {
+		if k.typ.Kind() == reflect.String {
+			continue
+		}
+		switch v := getConfigValue(data, k.path).(type) {
+		case string:
+			value, err := k.parse(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid config %s: %w", k.name(), err)
+			}
+			setConfigValue(data, k.path, value)
+		case int, int64, uint64, float64:
+			// a bare number would be taken as nanoseconds, which is never intended
+			if k.typ == durationType && fmt.Sprint(v) != "0" {
+				return nil, fmt.Errorf("invalid config %s: duration %v must have a unit, e.g. \"%vs\"", k.name(), v, v)
+			}
+		}
+	}
+	for _, k := range keys {
+		v, ok := l.lookup(k)
+		if !ok {
+			continue
+		}
+		value, err := k.parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config %s: %w", k.name(), err)
+		}
+		setConfigValue(data, k.path, value)
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	cfg := DefaultConfig()
+	if err = json.Unmarshal(b, cfg); err != nil {
+		return nil, fmt.Errorf("decode config failed: %w", err)
+	}
+	if err = binding.Validator.ValidateStruct(cfg); err != nil {
+		return nil, fmt.Errorf("invalid config: %s", validator.Error(err))
+	}
+	return cfg, nil
+}
+
+// RegisterConfigFlags register flags of all config keys to fs, e.g. -port, -view.tpl_dir,
+// only flags set in command line overlay the config
+func RegisterConfigFlags(fs *flag.FlagSet) {
+	for _, k := range configKeys(reflect.TypeOf(Config{}), nil) {
+		if fs.Lookup(k.name()) == nil {
+			fs.String(k.name(), "", "config "+strings.Join(k.path, "."))
+		}
+	}
+}
+
+// readConfigFile read the config file into a map by extension
+func readConfigFile(path string) (map[string]interface{}, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(b, &data)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &data)
+	case ".toml":
+		err = toml.Unmarshal(b, &data)
+	default:
+		return nil, fmt.Errorf("unsupported config file %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse config file %s failed: %w", path, err)
+	}
+	return normalizeConfigMap(data).(map[string]interface{}), nil
+}
+
+// normalizeConfigMap convert maps with non-string keys (e.g. yaml error_templates) to map[string]interface{},
+// so that it can be encoded as json
+func normalizeConfigMap(v interface{}) interface{} {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		for k, item := range m {
+			m[k] = normalizeConfigMap(item)
+		}
+		return m
+	case map[interface{}]interface{}:
+		nm := make(map[string]interface{}, len(m))
+		for k, item := range m {
+			nm[fmt.Sprint(k)] = normalizeConfigMap(item)
+		}
+		return nm
+	case []interface{}:
+		for i, item := range m {
+			m[i] = normalizeConfigMap(item)
+		}
+		return m
+	}
+	return v
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// configKey a leaf setting of config
+type configKey struct {
+	path []string // keys of json tags, e.g. ["view", "tpl_dir"]
+	typ  reflect.Type
+}
+
+// name get the name of key used by flags, the server section is omitted, e.g. "port", "view.tpl_dir"
+func (k configKey) name() string {
+	path := k.path
+	if path[0] == "server" {
+		path = path[1:]
+	}
+	return strings.Join(path, ".")
+}
+
+// envName get the name of environment variable, e.g. GINX_PORT, GINX_VIEW_TPL_DIR
+func (k configKey) envName(prefix string) string {
+	return strings.ToUpper(prefix + "_" + strings.ReplaceAll(k.name(), ".", "_"))
+}
+
+// parse parse the string value by the type of key
+func (k configKey) parse(s string) (interface{}, error) {
+	t := k.typ
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, err
+		}
+		return int64(d), nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return s, nil
+	case reflect.Bool:
+		return strconv.ParseBool(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(s, 0, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(s, 0, 64)
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(s, 64)
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.String {
+			items := make([]string, 0)
+			for _, item := range strings.Split(s, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			return items, nil
+		}
+	}
+	return nil, errors.New("unsupported type " + t.String())
+}
+
+// lookup get the value of key from flags or environment variables, flags take precedence
+func (l *configLoader) lookup(k configKey) (string, bool) {
+	if l.flags != nil {
+		var value string
+		var found bool
+		l.flags.Visit(func(f *flag.Flag) {
+			if f.Name == k.name() {
+				value, found = f.Value.String(), true
+			}
+		})
+		if found {
+			return value, true
+		}
+	}
+	if l.envPrefix == "" {
+		return "", false
+	}
+	// empty variables are treated as not set
+	value := os.Getenv(k.envName(l.envPrefix))
+	return value, value != ""
+}
+
+// configKeys collect the leaf settings of struct type by json tags, maps and fields without json names are skipped
+func configKeys(t reflect.Type, prefix []string) []configKey {
+	keys := make([]configKey, 0)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" || !f.IsExported() {
+			continue
+		}
+		path := append(append([]string{}, prefix...), name)
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct {
+			ft = ft.Elem()
+		}
+		switch {
+		case ft.Kind() == reflect.Struct:
+			keys = append(keys, configKeys(ft, path)...)
+		case ft.Kind() == reflect.Map || ft.Kind() == reflect.Interface:
+			continue
+		default:
+			keys = append(keys, configKey{path: path, typ: f.Type})
+		}
+	}
+	return keys
+}
+
+// getConfigValue get the value at path of config data
+func getConfigValue(data map[string]interface{}, path []string) interface{} {
+	var v interface{} = data
+	for _, p := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[p]
+	}
+	return v
+}
+
+// setConfigValue set the value at path of config data, maps are created if not exist
+func setConfigValue(data map[string]interface{}, path []string, value interface{}) {
+	m := data
+	for _, p := range path[:len(path)-1] {
+		sub, ok := m[p].(map[string]interface{})
+		if !ok {
+			sub = make(map[string]interface{})
+			m[p] = sub
+		}
+		m = sub
+	}
+	m[path[len(path)-1]] = value
+}
@@ -0,0 +1,233 @@
+package ginx
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// the key for csrf token cache
+	csrfTokenKey = "__ginx_csrf_token__"
+	// length in bytes of the random part of csrf token
+	csrfTokenLength = 32
+	// min length in bytes of the secret to sign csrf tokens
+	csrfSecretMinLength = 16
+)
+
+// ErrCSRFTokenInvalid the csrf token is missing or mismatched
+var ErrCSRFTokenInvalid = errors.New("invalid csrf token")
+
+// CSRFOptions csrf protection options
+type CSRFOptions struct {
+	Secret       []byte                  // key to sign tokens, required, it should be the same for all instances of the service
+	CookieName   string                  // name of the cookie which saves the token
+	CookiePath   string                  // cookie path
+	CookieDomain string                  // cookie domain
+	MaxAge       int                     // cookie max age in seconds, 0 means a session cookie
+	Secure       bool                    // send cookie over https only
+	SameSite     http.SameSite           // cookie SameSite mode
+	FieldName    string                  // form field name of the token
+	HeaderName   string                  // request header name of the token, for ajax requests
+	ExemptPaths  []string                // path prefixes that skip verification, e.g. "/api/"
+	ExemptFunc   func(*gin.Context) bool // customized exemption check
+	ErrorMessage string                  // message shown when verification failed, ErrCSRFTokenInvalid is used if empty
+}
+
+// DefaultCSRFOptions create default csrf options
+func DefaultCSRFOptions() *CSRFOptions {
+	return &CSRFOptions{
+		CookieName:   "_csrf",
+		CookiePath:   "/",
+		MaxAge:       0,
+		Secure:       false,
+		SameSite:     http.SameSiteLaxMode,
+		FieldName:    "_csrf",
+		HeaderName:   "X-CSRF-Token",
+		ExemptPaths:  make([]string, 0),
+		ErrorMessage: "",
+	}
+}
+
+// csrfOptions global csrf options, nil means csrf protection is disabled
+var csrfOptions *CSRFOptions
+
+// UseCSRF enable csrf protection for page handlers, the token will be saved in a cookie
+// and should be submitted with every unsafe request by form field or request header.
+// Templates can use {{ csrfField }} to output a hidden input, or {{ csrfToken }} to get the token.
+//
+// Tokens are random values signed by HMAC-SHA256 with opts.Secret, so that a token planted in the cookie
+// by others, e.g. from a sibling subdomain or over plain http, is rejected unless it was issued by the server.
+// The token is not bound to a session, a valid token issued to an attacker can still be planted to a victim,
+// so the cookie should be protected by Secure, and by the __Host- prefix of CookieName where possible.
+// An error is returned if the secret is shorter than 16 bytes.
+func UseCSRF(opts *CSRFOptions) error {
+	if opts == nil {
+		opts = DefaultCSRFOptions()
+	}
+	if len(opts.Secret) < csrfSecretMinLength {
+		return fmt.Errorf("csrf secret must be at least %d bytes", csrfSecretMinLength)
+	}
+	csrfOptions = opts
+	RegisterPageFunc("csrfToken", func(p *Page) interface{} {
+		return func() string {
+			if p == nil {
+				return ""
+			}
+			return p.CSRFToken()
+		}
+	})
+	RegisterPageFunc("csrfField", func(p *Page) interface{} {
+		return func() template.HTML {
+			if p == nil {
+				return ""
+			}
+			return p.CSRFField()
+		}
+	})
+	return nil
+}
+
+// csrfEnabled check whether csrf protection is enabled
+func csrfEnabled() bool {
+	return csrfOptions != nil
+}
+
+// csrfSign get the signature of the random part of token
+func csrfSign(b []byte) []byte {
+	mac := hmac.New(sha256.New, csrfOptions.Secret)
+	mac.Write(b)
+	return mac.Sum(nil)
+}
+
+// generateCSRFToken generate a new token, which is a random value followed by its signature
+func generateCSRFToken() (string, error) {
+	b := make([]byte, csrfTokenLength, csrfTokenLength+sha256.Size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(append(b, csrfSign(b)...)), nil
+}
+
+// validCSRFToken check whether the token is signed by the secret
+func validCSRFToken(token string) bool {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(b) != csrfTokenLength+sha256.Size {
+		return false
+	}
+	return hmac.Equal(b[csrfTokenLength:], csrfSign(b[:csrfTokenLength]))
+}
+
+// CSRFToken get the csrf token of current session, a new token will be generated and
+// saved into cookie if not exists or not signed by the secret.
+// It returns empty string if csrf protection is disabled.
+func CSRFToken(c *gin.Context) string {
+	if !csrfEnabled() {
+		return ""
+	}
+	if v, ok := c.Get(csrfTokenKey); ok {
+		return v.(string)
+	}
+	token, err := c.Cookie(csrfOptions.CookieName)
+	if err != nil || !validCSRFToken(token) {
+		token, err = generateCSRFToken()
+		if err != nil {
+			return ""
+		}
+		http.SetCookie(c.Writer, &http.Cookie{
+			Name:     csrfOptions.CookieName,
+			Value:    token,
+			Path:     csrfOptions.CookiePath,
+			Domain:   csrfOptions.CookieDomain,
+			MaxAge:   csrfOptions.MaxAge,
+			Secure:   csrfOptions.Secure,
+			HttpOnly: true,
+			SameSite: csrfOptions.SameSite,
+		})
+	}
+	c.Set(csrfTokenKey, token)
+	return token
+}
+
+// CSRFField get a hidden input field which contains the csrf token
+func CSRFField(c *gin.Context) template.HTML {
+	token := CSRFToken(c)
+	if token == "" {
+		return ""
+	}
+	return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`,
+		template.HTMLEscapeString(csrfOptions.FieldName), template.HTMLEscapeString(token)))
+}
+
+// csrfSafeMethod check if the request method is safe, safe requests won't be verified
+func csrfSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// csrfExempt check if current request is exempted from verification
+func csrfExempt(c *gin.Context) bool {
+	for _, prefix := range csrfOptions.ExemptPaths {
+		if prefix != "" && strings.HasPrefix(c.Request.URL.Path, prefix) {
+			return true
+		}
+	}
+	if csrfOptions.ExemptFunc != nil && csrfOptions.ExemptFunc(c) {
+		return true
+	}
+	return false
+}
+
+// csrfError get the error of verification failure
+func csrfError() error {
+	if csrfOptions.ErrorMessage == "" {
+		return ErrCSRFTokenInvalid
+	}
+	return errors.New(csrfOptions.ErrorMessage)
+}
+
+// VerifyCSRF verify the csrf token of current request, the token in cookie must be signed by the secret
+// and equal to the submitted one. Safe methods and exempted requests are always passed.
+func VerifyCSRF(c *gin.Context) error {
+	if !csrfEnabled() || csrfSafeMethod(c.Request.Method) || csrfExempt(c) {
+		return nil
+	}
+	expected, err := c.Cookie(csrfOptions.CookieName)
+	if err != nil || !validCSRFToken(expected) {
+		return csrfError()
+	}
+	actual := c.GetHeader(csrfOptions.HeaderName)
+	if actual == "" {
+		actual = c.PostForm(csrfOptions.FieldName)
+	}
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) != 1 {
+		return csrfError()
+	}
+	return nil
+}
+
+// CSRFMiddleware create a gin middleware to verify csrf token for routes not handled by NewPageHandler,
+// the failure will be shown by the api responser
+func CSRFMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := VerifyCSRF(c); err != nil {
+			getApiResponser().Response(c, http.StatusForbidden, err.Error())
+			c.Abort()
+			return
+		}
+		CSRFToken(c)
+		c.Next()
+	}
+}
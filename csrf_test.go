@@ -0,0 +1,50 @@
+package ginx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestCSRFSignedToken checks that only tokens signed by the secret pass verification
+func TestCSRFSignedToken(t *testing.T) {
+	if err := UseCSRF(DefaultCSRFOptions()); err == nil {
+		t.Fatal("expected error of missing secret")
+	}
+	opts := DefaultCSRFOptions()
+	opts.Secret = []byte("0123456789abcdef0123456789abcdef")
+	if err := UseCSRF(opts); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		csrfOptions = nil
+	}()
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	issued := CSRFToken(c)
+	if !validCSRFToken(issued) {
+		t.Fatalf("issued token %q is not valid", issued)
+	}
+
+	verify := func(cookie, submitted string) error {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+		c.Request.AddCookie(&http.Cookie{Name: opts.CookieName, Value: cookie})
+		c.Request.Header.Set(opts.HeaderName, submitted)
+		return VerifyCSRF(c)
+	}
+	if err := verify(issued, issued); err != nil {
+		t.Fatalf("issued token: %s", err)
+	}
+	// a token chosen by an attacker for both the cookie and the form
+	if err := verify("planted", "planted"); err == nil {
+		t.Fatal("unsigned token passed")
+	}
+	csrfOptions.Secret = []byte("another secret of the service")
+	if err := verify(issued, issued); err == nil {
+		t.Fatal("token signed by another secret passed")
+	}
+}
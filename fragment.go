@@ -0,0 +1,143 @@
+package ginx
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultFragment the block rendered for fragment requests, it's the block filled by pages in layouts
+	defaultFragment = "content"
+	// the key for htmx triggers cache
+	hxTriggersKey = "__ginx_hx_triggers__"
+)
+
+// FragmentDetector detect whether the request wants a page fragment instead of the full page,
+// it returns the name of the template block to render, empty means rendering the full page
+type FragmentDetector func(c *gin.Context) string
+
+// fragmentDetector the global fragment detector, nil means full pages are always rendered
+var fragmentDetector FragmentDetector
+
+// UseFragmentDetector register a fragment detector, pages requested by htmx or turbo frames are rendered
+// as fragments without layout, e.g. ginx.UseFragmentDetector(ginx.DefaultFragmentDetector)
+func UseFragmentDetector(d FragmentDetector) {
+	fragmentDetector = d
+}
+
+// HeaderFragmentDetector create a fragment detector which renders the block if any of the headers is present
+func HeaderFragmentDetector(block string, headers ...string) FragmentDetector {
+	return func(c *gin.Context) string {
+		for _, h := range headers {
+			if c.GetHeader(h) != "" {
+				return block
+			}
+		}
+		return ""
+	}
+}
+
+// DefaultFragmentDetector render the "content" block for htmx requests (boosted requests excluded,
+// they swap the whole body) and turbo frame requests
+func DefaultFragmentDetector(c *gin.Context) string {
+	if IsHTMX(c) && c.GetHeader("HX-Boosted") != "true" {
+		return defaultFragment
+	}
+	if c.GetHeader("Turbo-Frame") != "" {
+		return defaultFragment
+	}
+	return ""
+}
+
+// IsHTMX check if the request is sent by htmx
+func IsHTMX(c *gin.Context) bool {
+	return c.GetHeader("HX-Request") == "true"
+}
+
+// HXRedirect redirect the client to location, htmx requests are redirected by the HX-Redirect header
+// which makes a full page navigation, other requests are redirected with http.StatusFound
+func HXRedirect(c *gin.Context, location string) {
+	if !IsHTMX(c) {
+		c.Redirect(http.StatusFound, location)
+		c.Abort()
+		return
+	}
+	c.Header("HX-Redirect", location)
+	c.Status(http.StatusOK)
+	c.Abort()
+}
+
+// HXTrigger trigger a client side event by the HX-Trigger header when the response is received,
+// the detail can be nil. It can be called multiple times to trigger multiple events.
+func HXTrigger(c *gin.Context, event string, detail interface{}) {
+	hxTrigger(c, "HX-Trigger", event, detail)
+}
+
+// HXTriggerAfterSwap trigger a client side event after the content is swapped
+func HXTriggerAfterSwap(c *gin.Context, event string, detail interface{}) {
+	hxTrigger(c, "HX-Trigger-After-Swap", event, detail)
+}
+
+// HXTriggerAfterSettle trigger a client side event after the content is settled
+func HXTriggerAfterSettle(c *gin.Context, event string, detail interface{}) {
+	hxTrigger(c, "HX-Trigger-After-Settle", event, detail)
+}
+
+// hxTrigger add the event to the trigger header, events are encoded as a json object of event => detail
+func hxTrigger(c *gin.Context, header, event string, detail interface{}) {
+	var triggers map[string]map[string]interface{}
+	if v, ok := c.Get(hxTriggersKey); ok {
+		triggers = v.(map[string]map[string]interface{})
+	} else {
+		triggers = make(map[string]map[string]interface{})
+		c.Set(hxTriggersKey, triggers)
+	}
+	events, ok := triggers[header]
+	if !ok {
+		events = make(map[string]interface{})
+		triggers[header] = events
+	}
+	events[event] = detail
+	b, err := json.Marshal(events)
+	if err != nil {
+		return
+	}
+	c.Header(header, string(b))
+}
+
+// Fragment get the name of the block to render, empty means rendering the full page
+func (p *Page) Fragment() string {
+	if p.fragmentSet {
+		return p.fragment
+	}
+	if fragmentDetector != nil {
+		return fragmentDetector(p.Ctx)
+	}
+	return ""
+}
+
+// SetFragment set the block to render instead of the full page, empty means rendering the full page
+func (p *Page) SetFragment(name string) {
+	p.fragment = name
+	p.fragmentSet = true
+}
+
+// AddOOBFragment add blocks rendered after the fragment for out-of-band swaps, the blocks should contain
+// elements with hx-swap-oob attribute. They are ignored when the full page is rendered.
+func (p *Page) AddOOBFragment(names ...string) {
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			p.oobFragments = append(p.oobFragments, name)
+		}
+	}
+}
+
+// ShowFragment render the block of page template without layout, the request is aborted after shown
+func (p *Page) ShowFragment(name string) error {
+	p.SetFragment(name)
+	defer p.Ctx.Abort()
+	return p.Show()
+}
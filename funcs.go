@@ -0,0 +1,376 @@
+package ginx
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-playground/locales"
+	"github.com/go-playground/locales/currency"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/zh"
+	"github.com/whencome/ginx/log"
+)
+
+// defaultLocale the locale used to format date, time, number and currency when not specified
+const defaultLocale = "en"
+
+var (
+	// localeTranslators registered locales for formatting
+	localeTranslators = map[string]locales.Translator{
+		"en": en.New(),
+		"zh": zh.New(),
+	}
+	// currencies currency codes supported by formatCurrency
+	currencies = map[string]currency.Type{
+		"AUD": currency.AUD,
+		"CAD": currency.CAD,
+		"CHF": currency.CHF,
+		"CNY": currency.CNY,
+		"EUR": currency.EUR,
+		"GBP": currency.GBP,
+		"HKD": currency.HKD,
+		"INR": currency.INR,
+		"JPY": currency.JPY,
+		"KRW": currency.KRW,
+		"RUB": currency.RUB,
+		"SGD": currency.SGD,
+		"TWD": currency.TWD,
+		"USD": currency.USD,
+	}
+	localeMutex sync.RWMutex
+)
+
+// RegisterLocale register locales used by formatting functions, e.g. fr.New() of github.com/go-playground/locales/fr
+func RegisterLocale(ts ...locales.Translator) {
+	localeMutex.Lock()
+	defer localeMutex.Unlock()
+	for _, t := range ts {
+		if t != nil {
+			localeTranslators[t.Locale()] = t
+		}
+	}
+}
+
+// RegisterCurrency register a currency code used by formatCurrency
+func RegisterCurrency(code string, t currency.Type) {
+	localeMutex.Lock()
+	defer localeMutex.Unlock()
+	currencies[strings.ToUpper(code)] = t
+}
+
+// localeTranslator find the translator of locale, "zh-CN" matches "zh_CN" and then "zh",
+// the default locale is used if not found
+func localeTranslator(locale string) locales.Translator {
+	localeMutex.RLock()
+	defer localeMutex.RUnlock()
+	locale = strings.ReplaceAll(locale, "-", "_")
+	if t, ok := localeTranslators[locale]; ok {
+		return t
+	}
+	if pos := strings.Index(locale, "_"); pos > 0 {
+		if t, ok := localeTranslators[locale[:pos]]; ok {
+			return t
+		}
+	}
+	return localeTranslators[defaultLocale]
+}
+
+// toFloat64 convert a number to float64
+func toFloat64(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case string:
+		return strconv.ParseFloat(n, 64)
+	case json.Number:
+		return n.Float64()
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	}
+	return 0, fmt.Errorf("%v is not a number", v)
+}
+
+// toTime convert time.Time, *time.Time or unix seconds to time.Time
+func toTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case *time.Time:
+		if t == nil {
+			return time.Time{}, nil
+		}
+		return *t, nil
+	}
+	n, err := toFloat64(v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%v is not a time", v)
+	}
+	return time.Unix(int64(n), 0), nil
+}
+
+// isEmpty check if v is nil or the zero value of its type
+func isEmpty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return rv.IsNil()
+	}
+	return rv.IsZero()
+}
+
+// buildURL build url with escaped query params, args are key/value pairs, or url.Values and maps to merge
+func buildURL(base string, args ...interface{}) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	for i := 0; i < len(args); i++ {
+		switch a := args[i].(type) {
+		case url.Values:
+			for k, vs := range a {
+				for _, v := range vs {
+					q.Add(k, v)
+				}
+			}
+		case map[string]interface{}:
+			for k, v := range a {
+				q.Set(k, fmt.Sprint(v))
+			}
+		case map[string]string:
+			for k, v := range a {
+				q.Set(k, v)
+			}
+		default:
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("missing value of query param %v", a)
+			}
+			q.Add(fmt.Sprint(a), fmt.Sprint(args[i+1]))
+			i++
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// formatDate format date by locale and style: short, medium, long or full
+func formatDate(t locales.Translator, style string, v interface{}) (string, error) {
+	tm, err := toTime(v)
+	if err != nil {
+		return "", err
+	}
+	switch style {
+	case "short":
+		return t.FmtDateShort(tm), nil
+	case "medium", "":
+		return t.FmtDateMedium(tm), nil
+	case "long":
+		return t.FmtDateLong(tm), nil
+	case "full":
+		return t.FmtDateFull(tm), nil
+	}
+	return "", fmt.Errorf("unknown date style %s", style)
+}
+
+// formatTime format time by locale and style: short, medium, long or full
+func formatTime(t locales.Translator, style string, v interface{}) (string, error) {
+	tm, err := toTime(v)
+	if err != nil {
+		return "", err
+	}
+	switch style {
+	case "short":
+		return t.FmtTimeShort(tm), nil
+	case "medium", "":
+		return t.FmtTimeMedium(tm), nil
+	case "long":
+		return t.FmtTimeLong(tm), nil
+	case "full":
+		return t.FmtTimeFull(tm), nil
+	}
+	return "", fmt.Errorf("unknown time style %s", style)
+}
+
+// formatNumber format number by locale with the given decimals
+func formatNumber(t locales.Translator, decimals int, v interface{}) (string, error) {
+	n, err := toFloat64(v)
+	if err != nil {
+		return "", err
+	}
+	if decimals < 0 {
+		decimals = 0
+	}
+	return t.FmtNumber(n, uint64(decimals)), nil
+}
+
+// formatCurrency format amount by locale and currency code, e.g. USD
+func formatCurrency(t locales.Translator, code string, v interface{}) (string, error) {
+	n, err := toFloat64(v)
+	if err != nil {
+		return "", err
+	}
+	localeMutex.RLock()
+	c, ok := currencies[strings.ToUpper(code)]
+	localeMutex.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("unknown currency %s", code)
+	}
+	return t.FmtCurrency(n, 2, c), nil
+}
+
+// localeFuncNames names of the formatting functions
+var localeFuncNames = map[string]bool{
+	"formatDate":     true,
+	"formatTime":     true,
+	"formatNumber":   true,
+	"formatCurrency": true,
+}
+
+// localeFuncs functions formatting by the given locale
+func localeFuncs(locale string) template.FuncMap {
+	t := localeTranslator(locale)
+	return template.FuncMap{
+		"formatDate": func(style string, v interface{}) (string, error) {
+			return formatDate(t, style, v)
+		},
+		"formatTime": func(style string, v interface{}) (string, error) {
+			return formatTime(t, style, v)
+		},
+		"formatNumber": func(decimals int, v interface{}) (string, error) {
+			return formatNumber(t, decimals, v)
+		},
+		"formatCurrency": func(code string, v interface{}) (string, error) {
+			return formatCurrency(t, code, v)
+		},
+	}
+}
+
+// defaultFuncs the built-in template functions of view
+func (view *View) defaultFuncs() template.FuncMap {
+	m := template.FuncMap{
+		// date formats time by go layout, e.g. {{ date "2006-01-02" .Created }}
+		"date": func(layout string, v interface{}) (string, error) {
+			t, err := toTime(v)
+			if err != nil {
+				return "", err
+			}
+			return t.Format(layout), nil
+		},
+		"dict": func(pairs ...interface{}) (map[string]interface{}, error) {
+			if len(pairs)%2 != 0 {
+				return nil, errors.New("dict requires key/value pairs")
+			}
+			m := make(map[string]interface{}, len(pairs)/2)
+			for i := 0; i < len(pairs); i += 2 {
+				k, ok := pairs[i].(string)
+				if !ok {
+					return nil, fmt.Errorf("dict key %v is not a string", pairs[i])
+				}
+				m[k] = pairs[i+1]
+			}
+			return m, nil
+		},
+		"list": func(items ...interface{}) []interface{} {
+			return items
+		},
+		"json": func(v interface{}) (template.JS, error) {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return "", err
+			}
+			return template.JS(b), nil
+		},
+		"safeHTML": func(s string) template.HTML {
+			return template.HTML(s)
+		},
+		"safeURL": func(s string) template.URL {
+			return template.URL(s)
+		},
+		"safeJS": func(s string) template.JS {
+			return template.JS(s)
+		},
+		// truncate limits the string to n characters, e.g. {{ .Content | truncate 100 }}
+		"truncate": func(n int, s string) string {
+			if n < 0 || utf8.RuneCountInString(s) <= n {
+				return s
+			}
+			return string([]rune(s)[:n]) + "..."
+		},
+		// default returns def if v is empty, e.g. {{ .Name | default "guest" }}
+		"default": func(def, v interface{}) interface{} {
+			if isEmpty(v) {
+				return def
+			}
+			return v
+		},
+		// url builds url with escaped query params, e.g. {{ url "/search" "q" .Keyword "page" 2 }}
+		"url": buildURL,
+		// urlPath joins escaped path segments, e.g. {{ urlPath "users" .Name "edit" }}
+		"urlPath": func(segments ...interface{}) string {
+			escaped := make([]string, 0, len(segments))
+			for _, s := range segments {
+				escaped = append(escaped, url.PathEscape(fmt.Sprint(s)))
+			}
+			return "/" + strings.Join(escaped, "/")
+		},
+		// urlFor builds the url of a named route, e.g. {{ urlFor "user.show" "id" .User.ID }}
+		"urlFor": URLFor,
+		// asset gets the url of static asset with content hash for cache busting, e.g. {{ asset "css/app.css" }}
+		"asset": view.assetURL,
+		// paginate renders the page links of paged data, e.g. {{ paginate . .Data.users }}
+		"paginate": paginate,
+	}
+	for k, f := range localeFuncs(view.locale) {
+		m[k] = f
+	}
+	return m
+}
+
+// assetURL get the url of static asset with a version param of content hash
+func (view *View) assetURL(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	u := path.Join("/", view.staticPath, name)
+	if view.staticDir == "" {
+		return u
+	}
+	if v, ok := view.assetHashes.Load(name); ok {
+		return u + "?v=" + v.(string)
+	}
+	f, err := view.StaticFS(view.staticDir).Open("/" + name)
+	if err != nil {
+		log.Errorf("open asset %s failed: %s", name, err)
+		return u
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		log.Errorf("read asset %s failed: %s", name, err)
+		return u
+	}
+	v := hex.EncodeToString(h.Sum(nil))[:8]
+	view.assetHashes.Store(name, v)
+	return u + "?v=" + v
+}
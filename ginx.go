@@ -1,11 +1,11 @@
 package ginx
 
 import (
+	"errors"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/whencome/ginx/log"
@@ -121,6 +121,7 @@ func NewApiHandler(r Request, f ApiHandlerFunc, ms ...ApiMiddleware) gin.Handler
 				c.Abort()
 				return
 			}
+			normalizePagination(req)
 			c.Set(requestKey, req)
 			if vr, ok := req.(ValidatableRequest); ok {
 				if err := vr.Validate(); err != nil {
@@ -188,15 +189,49 @@ func UsePageMiddleware(ms ...PageMiddleware) {
 	pageMiddlewares = append(pageMiddlewares, ms...)
 }
 
+// PageLayout create a page middleware which sets the layout of page, empty means no layout
+func PageLayout(name string) PageMiddleware {
+	return func(next PageHandlerFunc) PageHandlerFunc {
+		return func(c *gin.Context, p *Page, r Request) error {
+			p.SetLayout(name)
+			return next(c, p, r)
+		}
+	}
+}
+
 // NewPageHandler 创建一个页面处理方法
+// v - renderer of page, usually a *View
 // t - template of current page
 // r - request
 // f - handler func
 // ms - middleware list, allow empty
-func NewPageHandler(v *View, t string, r Request, f PageHandlerFunc, ms ...PageMiddleware) gin.HandlerFunc {
+func NewPageHandler(v Renderer, t string, r Request, f PageHandlerFunc, ms ...PageMiddleware) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		p := NewPage(c, v, t)
+		// execute page initializers
+		if err := p.Initialize(); err != nil {
+			if !errors.Is(err, ErrPageAborted) && !c.IsAborted() {
+				if _, ok := err.(ApiError); !ok {
+					p.SetStatus(http.StatusInternalServerError)
+				}
+				_ = p.ShowWithError(err)
+			}
+			c.Abort()
+			return
+		}
+		// verify csrf token for unsafe requests
+		if csrfEnabled() {
+			if err := VerifyCSRF(c); err != nil {
+				p.SetStatus(http.StatusForbidden)
+				_ = p.ShowWithError(err)
+				c.Abort()
+				return
+			}
+			// make sure the token cookie is set before any output
+			CSRFToken(c)
+		}
 		if f == nil {
+			p.SetStatus(http.StatusNotImplemented)
 			_ = p.ShowWithError("service not implemented")
 			c.Abort()
 			return
@@ -206,10 +241,12 @@ func NewPageHandler(v *View, t string, r Request, f PageHandlerFunc, ms ...PageM
 		if r != nil {
 			req = NewRequest(r)
 			if err := c.ShouldBind(req); err != nil {
+				p.SetStatus(http.StatusBadRequest)
 				_ = p.ShowWithError(validator.Error(err))
 				c.Abort()
 				return
 			}
+			normalizePagination(req)
 			c.Set(requestKey, req)
 			if vr, ok := req.(ValidatableRequest); ok {
 				if err := vr.Validate(); err != nil {
@@ -260,8 +297,6 @@ func Wait(releaseFunc func()) {
 			log.Infof("execute release func...")
 			releaseFunc()
 		}
-		// wait 1 second before exit
-		time.Sleep(1 * time.Second)
 		log.Infof("exit app...")
 		os.Exit(0)
 	}
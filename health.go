@@ -0,0 +1,239 @@
+package ginx
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HealthStatus status of health checks
+type HealthStatus string
+
+const (
+	HealthUp   HealthStatus = "up"
+	HealthDown HealthStatus = "down"
+)
+
+// HealthCheckFunc check a dependency such as a database, nil means healthy.
+// The context is cancelled when the check timed out.
+type HealthCheckFunc func(ctx context.Context) error
+
+// HealthCheck a named health check
+type HealthCheck struct {
+	Name     string          // name of check, it's the key in the report
+	Func     HealthCheckFunc // the check function
+	Timeout  time.Duration   // max duration of the check, the default timeout of checker is used if zero
+	Liveness bool            // also checked by the liveness endpoint, only readiness by default
+}
+
+// HealthCheckOption set options of a health check
+type HealthCheckOption func(c *HealthCheck)
+
+// WithHealthCheckTimeout set the timeout of health check
+func WithHealthCheckTimeout(d time.Duration) HealthCheckOption {
+	return func(c *HealthCheck) {
+		c.Timeout = d
+	}
+}
+
+// WithLivenessCheck make the health check also checked by the liveness endpoint,
+// a failed liveness check usually makes the process restarted, use it carefully
+func WithLivenessCheck() HealthCheckOption {
+	return func(c *HealthCheck) {
+		c.Liveness = true
+	}
+}
+
+// HealthCheckResult result of a health check
+type HealthCheckResult struct {
+	Status   HealthStatus `json:"status"`
+	Error    string       `json:"error,omitempty"`
+	Duration string       `json:"duration"`
+}
+
+// HealthReport result of health checks, it's responded as json by the health endpoints
+type HealthReport struct {
+	Status  HealthStatus                 `json:"status"`
+	Message string                       `json:"message,omitempty"`
+	Checks  map[string]HealthCheckResult `json:"checks,omitempty"`
+}
+
+// HealthChecker a registry of health checks, the checks run concurrently
+type HealthChecker struct {
+	mu      sync.RWMutex
+	checks  []HealthCheck
+	timeout time.Duration
+}
+
+// NewHealthChecker create a health checker, timeout is the default timeout of each check, zero means no limit
+func NewHealthChecker(timeout time.Duration) *HealthChecker {
+	return &HealthChecker{
+		checks:  make([]HealthCheck, 0),
+		timeout: timeout,
+	}
+}
+
+// Register add a health check, a check with the same name is replaced
+func (hc *HealthChecker) Register(name string, f HealthCheckFunc, opts ...HealthCheckOption) {
+	if f == nil {
+		return
+	}
+	c := HealthCheck{Name: name, Func: f}
+	for _, o := range opts {
+		o(&c)
+	}
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	for i := range hc.checks {
+		if hc.checks[i].Name == name {
+			hc.checks[i] = c
+			return
+		}
+	}
+	hc.checks = append(hc.checks, c)
+}
+
+// Unregister remove the health check
+func (hc *HealthChecker) Unregister(name string) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	for i := range hc.checks {
+		if hc.checks[i].Name == name {
+			hc.checks = append(hc.checks[:i], hc.checks[i+1:]...)
+			return
+		}
+	}
+}
+
+// Check run the health checks concurrently, only the liveness checks are run if liveness is true.
+// The status is down if any check failed or timed out.
+func (hc *HealthChecker) Check(ctx context.Context, liveness bool) HealthReport {
+	hc.mu.RLock()
+	checks := make([]HealthCheck, 0, len(hc.checks))
+	for _, c := range hc.checks {
+		if !liveness || c.Liveness {
+			checks = append(checks, c)
+		}
+	}
+	hc.mu.RUnlock()
+	report := HealthReport{Status: HealthUp}
+	if len(checks) == 0 {
+		return report
+	}
+	results := make([]HealthCheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i := range checks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = hc.run(ctx, checks[i])
+		}(i)
+	}
+	wg.Wait()
+	report.Checks = make(map[string]HealthCheckResult, len(checks))
+	for i, c := range checks {
+		report.Checks[c.Name] = results[i]
+		if results[i].Status != HealthUp {
+			report.Status = HealthDown
+		}
+	}
+	return report
+}
+
+// run run the check with timeout, the check keeps running in background after timed out
+func (hc *HealthChecker) run(ctx context.Context, c HealthCheck) HealthCheckResult {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = hc.timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	result := make(chan error, 1)
+	go func() {
+		result <- callHealthCheck(ctx, c)
+	}()
+	var err error
+	select {
+	case err = <-result:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %s", time.Since(start).Round(time.Millisecond))
+	}
+	r := HealthCheckResult{
+		Status:   HealthUp,
+		Duration: time.Since(start).String(),
+	}
+	if err != nil {
+		r.Status = HealthDown
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// callHealthCheck call the check function, panics are recovered as errors
+func callHealthCheck(ctx context.Context, c HealthCheck) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return c.Func(ctx)
+}
+
+// HealthChecker get the health checker of server, checks registered are run by the health endpoints
+func (s *HTTPServer) HealthChecker() *HealthChecker {
+	return s.health
+}
+
+// AddHealthCheck register a health check to the server
+func (s *HTTPServer) AddHealthCheck(name string, f HealthCheckFunc, opts ...HealthCheckOption) {
+	s.health.Register(name, f, opts...)
+}
+
+// mountHealthEndpoints mount the liveness and readiness endpoints if their paths are set
+func (s *HTTPServer) mountHealthEndpoints() {
+	if p := s.options.LivenessPath; p != "" {
+		s.engine.GET(p, s.livenessHandler)
+		s.engine.HEAD(p, s.livenessHandler)
+	}
+	if p := s.options.ReadinessPath; p != "" {
+		s.engine.GET(p, s.readinessHandler)
+		s.engine.HEAD(p, s.readinessHandler)
+	}
+}
+
+// livenessHandler respond whether the process is alive, only liveness checks are run
+func (s *HTTPServer) livenessHandler(c *gin.Context) {
+	writeHealthReport(c, s.health.Check(c.Request.Context(), true))
+}
+
+// readinessHandler respond whether the server is ready to serve requests, it's down before the server
+// started and once stopping, all checks are run otherwise
+func (s *HTTPServer) readinessHandler(c *gin.Context) {
+	if !s.Ready() {
+		writeHealthReport(c, HealthReport{
+			Status:  HealthDown,
+			Message: "server is not ready",
+		})
+		return
+	}
+	writeHealthReport(c, s.health.Check(c.Request.Context(), false))
+}
+
+// writeHealthReport respond the report as json directly instead of the api responser,
+// http.StatusServiceUnavailable is used if the status is down
+func writeHealthReport(c *gin.Context, report HealthReport) {
+	code := http.StatusOK
+	if report.Status != HealthUp {
+		code = http.StatusServiceUnavailable
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(code, report)
+}
@@ -0,0 +1,120 @@
+package ginx
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/whencome/ginx/i18n"
+)
+
+const (
+	// the key for locale cache
+	localeKey = "__ginx_locale__"
+	// the query param and cookie name to choose locale
+	localeParam = "lang"
+)
+
+// LocaleDetector detect the locale of current request
+type LocaleDetector func(c *gin.Context) string
+
+var (
+	// i18nBundle the message catalogs used by T
+	i18nBundle *i18n.Bundle
+	// localeDetector the detector of request locale
+	localeDetector LocaleDetector = DefaultLocaleDetector
+)
+
+// UseI18n register the message catalogs, templates can use {{ T "key" args }} to translate
+// messages and {{ locale }} to get the locale of current request. Formatting functions follow the
+// request locale too, unless the view sets its locale; functions added by View.AddFuncs take precedence.
+func UseI18n(b *i18n.Bundle) {
+	if b == nil {
+		return
+	}
+	i18nBundle = b
+	RegisterPageFunc("T", func(p *Page) interface{} {
+		return func(key string, args ...interface{}) string {
+			if p == nil {
+				return i18nBundle.Translate(i18nBundle.DefaultLanguage(), key, args...)
+			}
+			return p.T(key, args...)
+		}
+	})
+	RegisterPageFunc("locale", func(p *Page) interface{} {
+		return func() string {
+			if p == nil {
+				return i18nBundle.DefaultLanguage()
+			}
+			return p.Locale()
+		}
+	})
+	// format date, time, number and currency in the locale of current request
+	for name := range localeFuncNames {
+		name := name
+		RegisterPageFunc(name, func(p *Page) interface{} {
+			locale := i18nBundle.DefaultLanguage()
+			if p != nil {
+				locale = p.Locale()
+			}
+			return localeFuncs(locale)[name]
+		})
+	}
+}
+
+// UseLocaleDetector register a customized locale detector
+func UseLocaleDetector(f LocaleDetector) {
+	if f != nil {
+		localeDetector = f
+	}
+}
+
+// DefaultLocaleDetector detect locale by the "lang" query param, the "lang" cookie and
+// the Accept-Language header in order, the result is matched against the languages of i18n bundle
+func DefaultLocaleDetector(c *gin.Context) string {
+	langs := make([]string, 0)
+	if l := c.Query(localeParam); l != "" {
+		langs = append(langs, l)
+	}
+	if l, err := c.Cookie(localeParam); err == nil && l != "" {
+		langs = append(langs, l)
+	}
+	langs = append(langs, i18n.ParseAcceptLanguage(c.GetHeader("Accept-Language"))...)
+	if i18nBundle == nil {
+		if len(langs) > 0 {
+			return langs[0]
+		}
+		return defaultLocale
+	}
+	return i18nBundle.Match(langs...)
+}
+
+// Locale get the locale of current request
+func Locale(c *gin.Context) string {
+	if v, ok := c.Get(localeKey); ok {
+		return v.(string)
+	}
+	l := localeDetector(c)
+	c.Set(localeKey, l)
+	return l
+}
+
+// SetLocale set the locale of current request, e.g. by the setting of current user
+func SetLocale(c *gin.Context, l string) {
+	c.Set(localeKey, l)
+}
+
+// T translate message of key in the locale of current request, the key is returned if i18n is not enabled
+func T(c *gin.Context, key string, args ...interface{}) string {
+	if i18nBundle == nil {
+		return key
+	}
+	return i18nBundle.Translate(Locale(c), key, args...)
+}
+
+// Locale get the locale of current page
+func (p *Page) Locale() string {
+	return Locale(p.Ctx)
+}
+
+// T translate message of key in the locale of current page
+func (p *Page) T(key string, args ...interface{}) string {
+	return T(p.Ctx, key, args...)
+}
@@ -0,0 +1,363 @@
+package i18n
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Message a translated message, a message without plural forms has only Other
+type Message struct {
+	Zero  string
+	One   string
+	Two   string
+	Few   string
+	Many  string
+	Other string
+}
+
+// form get the text of plural category, Other is used if the category is not defined
+func (m *Message) form(category string) string {
+	var s string
+	switch category {
+	case PluralZero:
+		s = m.Zero
+	case PluralOne:
+		s = m.One
+	case PluralTwo:
+		s = m.Two
+	case PluralFew:
+		s = m.Few
+	case PluralMany:
+		s = m.Many
+	}
+	if s == "" {
+		s = m.Other
+	}
+	return s
+}
+
+// Bundle a set of message catalogs of all languages
+type Bundle struct {
+	defaultLang string
+	// messages language => key => message
+	messages map[string]map[string]*Message
+	mu       sync.RWMutex
+}
+
+// NewBundle create a bundle, messages of the default language are used when not translated
+func NewBundle(defaultLang string) *Bundle {
+	return &Bundle{
+		defaultLang: normalizeLanguage(defaultLang),
+		messages:    make(map[string]map[string]*Message),
+	}
+}
+
+// DefaultLanguage get the default language
+func (b *Bundle) DefaultLanguage() string {
+	return b.defaultLang
+}
+
+// Languages get all languages which have messages
+func (b *Bundle) Languages() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	langs := make([]string, 0, len(b.messages))
+	for lang := range b.messages {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// AddMessages add messages of a language, nested maps are flattened with "." as key separator,
+// a map which only contains plural categories (zero, one, two, few, many, other) is a plural message
+func (b *Bundle) AddMessages(lang string, messages map[string]interface{}) error {
+	flat := make(map[string]*Message)
+	if err := flatten("", messages, flat); err != nil {
+		return err
+	}
+	lang = normalizeLanguage(lang)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.messages[lang] == nil {
+		b.messages[lang] = make(map[string]*Message)
+	}
+	for k, m := range flat {
+		b.messages[lang][k] = m
+	}
+	return nil
+}
+
+// LoadMessages parse messages in the format of json, yaml or toml
+func (b *Bundle) LoadMessages(lang string, data []byte, format string) error {
+	messages := make(map[string]interface{})
+	var err error
+	switch strings.ToLower(strings.TrimPrefix(format, ".")) {
+	case "json":
+		err = json.Unmarshal(data, &messages)
+	case "yaml", "yml":
+		err = yaml.Unmarshal(data, &messages)
+	case "toml":
+		err = toml.Unmarshal(data, &messages)
+	default:
+		return fmt.Errorf("unsupported message format: %s", format)
+	}
+	if err != nil {
+		return err
+	}
+	return b.AddMessages(lang, messages)
+}
+
+// LoadFile load a message file, the language is the last part of the file name without extension,
+// e.g. "en.json", "zh-CN.yaml" or "messages.fr.toml"
+func (b *Bundle) LoadFile(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	return b.loadFile(filepath.Base(file), data)
+}
+
+// LoadFS load all message files in dir of the file system, such as embed.FS
+func (b *Bundle) LoadFS(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() || !isMessageFile(e.Name()) {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return err
+		}
+		if err = b.loadFile(e.Name(), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadDir load all message files in the directory
+func (b *Bundle) LoadDir(dir string) error {
+	return b.LoadFS(os.DirFS(dir), ".")
+}
+
+// isMessageFile check if the file is a supported message file
+func isMessageFile(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".json", ".yaml", ".yml", ".toml":
+		return true
+	}
+	return false
+}
+
+// loadFile load messages by file name and content
+func (b *Bundle) loadFile(name string, data []byte) error {
+	ext := path.Ext(name)
+	lang := strings.TrimSuffix(name, ext)
+	if pos := strings.LastIndex(lang, "."); pos >= 0 {
+		lang = lang[pos+1:]
+	}
+	if err := b.LoadMessages(lang, data, ext); err != nil {
+		return fmt.Errorf("load %s failed: %w", name, err)
+	}
+	return nil
+}
+
+// isPluralMap check if all keys of m are plural categories
+func isPluralMap(m map[string]interface{}) bool {
+	if _, ok := m[PluralOther]; !ok {
+		return false
+	}
+	for k, v := range m {
+		switch k {
+		case PluralZero, PluralOne, PluralTwo, PluralFew, PluralMany, PluralOther:
+		default:
+			return false
+		}
+		if _, ok := v.(string); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// flatten flatten nested messages into key => message
+func flatten(prefix string, messages map[string]interface{}, flat map[string]*Message) error {
+	for k, v := range messages {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch mv := v.(type) {
+		case string:
+			flat[key] = &Message{Other: mv}
+		case map[string]interface{}:
+			if isPluralMap(mv) {
+				m := &Message{}
+				m.Zero, _ = mv[PluralZero].(string)
+				m.One, _ = mv[PluralOne].(string)
+				m.Two, _ = mv[PluralTwo].(string)
+				m.Few, _ = mv[PluralFew].(string)
+				m.Many, _ = mv[PluralMany].(string)
+				m.Other, _ = mv[PluralOther].(string)
+				flat[key] = m
+				continue
+			}
+			if err := flatten(key, mv, flat); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("invalid message %s: %v", key, v)
+		}
+	}
+	return nil
+}
+
+// lookup find message of the language, "zh-cn" falls back to "zh", then the default language
+func (b *Bundle) lookup(lang, key string) (*Message, string) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	lang = normalizeLanguage(lang)
+	for _, l := range []string{lang, baseLanguage(lang), b.defaultLang} {
+		if msgs, ok := b.messages[l]; ok {
+			if m, ok := msgs[key]; ok {
+				return m, l
+			}
+		}
+	}
+	return nil, lang
+}
+
+// Match find the best supported language of the preferred languages, the default language is
+// returned if none matched. The languages can be read from Accept-Language header by ParseAcceptLanguage.
+func (b *Bundle) Match(langs ...string) string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, lang := range langs {
+		lang = normalizeLanguage(lang)
+		if _, ok := b.messages[lang]; ok {
+			return lang
+		}
+		base := baseLanguage(lang)
+		if _, ok := b.messages[base]; ok {
+			return base
+		}
+		// "zh" matches "zh-cn"
+		for l := range b.messages {
+			if baseLanguage(l) == base {
+				return l
+			}
+		}
+	}
+	return b.defaultLang
+}
+
+// Translate translate the message of key in the language. Args are a map or key/value pairs
+// to replace the placeholders like {name} in the message, the "count" arg selects the plural form.
+// The key is returned if the message is not found.
+func (b *Bundle) Translate(lang, key string, args ...interface{}) string {
+	m, l := b.lookup(lang, key)
+	if m == nil {
+		return key
+	}
+	params := parseArgs(args...)
+	s := m.Other
+	if count, ok := params["count"]; ok {
+		if n, err := strconv.ParseFloat(count, 64); err == nil {
+			s = m.form(pluralCategory(l, n))
+		}
+	}
+	if len(params) == 0 {
+		return s
+	}
+	pairs := make([]string, 0, len(params)*2)
+	for k, v := range params {
+		pairs = append(pairs, "{"+k+"}", v)
+	}
+	return strings.NewReplacer(pairs...).Replace(s)
+}
+
+// parseArgs parse translation args into a map, a single number arg is treated as count
+func parseArgs(args ...interface{}) map[string]string {
+	params := make(map[string]string)
+	if len(args) == 1 {
+		rv := reflect.ValueOf(args[0])
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			params["count"] = fmt.Sprint(args[0])
+			return params
+		}
+	}
+	for i := 0; i < len(args); i++ {
+		switch a := args[i].(type) {
+		case map[string]interface{}:
+			for k, v := range a {
+				params[k] = fmt.Sprint(v)
+			}
+		case map[string]string:
+			for k, v := range a {
+				params[k] = v
+			}
+		default:
+			if i+1 < len(args) {
+				params[fmt.Sprint(a)] = fmt.Sprint(args[i+1])
+				i++
+			}
+		}
+	}
+	return params
+}
+
+// ParseAcceptLanguage parse the Accept-Language header, languages are sorted by quality
+func ParseAcceptLanguage(header string) []string {
+	type langQ struct {
+		lang string
+		q    float64
+	}
+	items := make([]langQ, 0)
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		lang, q := part, 1.0
+		if pos := strings.Index(part, ";"); pos >= 0 {
+			lang = strings.TrimSpace(part[:pos])
+			params := strings.TrimSpace(part[pos+1:])
+			if strings.HasPrefix(params, "q=") {
+				if v, err := strconv.ParseFloat(params[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if lang == "" || lang == "*" || q <= 0 {
+			continue
+		}
+		items = append(items, langQ{lang: lang, q: q})
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].q > items[j].q
+	})
+	langs := make([]string, 0, len(items))
+	for _, item := range items {
+		langs = append(langs, item.lang)
+	}
+	return langs
+}
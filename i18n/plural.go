@@ -0,0 +1,157 @@
+package i18n
+
+import (
+	"strings"
+	"sync"
+)
+
+// plural categories defined by CLDR
+const (
+	PluralZero  = "zero"
+	PluralOne   = "one"
+	PluralTwo   = "two"
+	PluralFew   = "few"
+	PluralMany  = "many"
+	PluralOther = "other"
+)
+
+// PluralRule get the plural category of a number
+type PluralRule func(n float64) string
+
+var (
+	// pluralRules plural rules of languages, keyed by base language
+	pluralRules = map[string]PluralRule{}
+	pluralMutex sync.RWMutex
+)
+
+// isInt check if n is an integer
+func isInt(n float64) bool {
+	return n == float64(int64(n))
+}
+
+// ruleOther languages without plural forms, e.g. zh, ja, ko
+func ruleOther(n float64) string {
+	return PluralOther
+}
+
+// ruleOneOther languages with singular form for 1 only, e.g. en, de, es
+func ruleOneOther(n float64) string {
+	if n == 1 {
+		return PluralOne
+	}
+	return PluralOther
+}
+
+// ruleFrench languages with singular form for 0 and 1, e.g. fr, pt
+func ruleFrench(n float64) string {
+	if n >= 0 && n < 2 {
+		return PluralOne
+	}
+	return PluralOther
+}
+
+// ruleSlavic east slavic languages, e.g. ru, uk
+func ruleSlavic(n float64) string {
+	if !isInt(n) {
+		return PluralOther
+	}
+	i := int64(n)
+	if i < 0 {
+		i = -i
+	}
+	switch {
+	case i%10 == 1 && i%100 != 11:
+		return PluralOne
+	case i%10 >= 2 && i%10 <= 4 && (i%100 < 12 || i%100 > 14):
+		return PluralFew
+	}
+	return PluralMany
+}
+
+// rulePolish polish language
+func rulePolish(n float64) string {
+	if !isInt(n) {
+		return PluralOther
+	}
+	i := int64(n)
+	switch {
+	case i == 1:
+		return PluralOne
+	case i%10 >= 2 && i%10 <= 4 && (i%100 < 12 || i%100 > 14):
+		return PluralFew
+	}
+	return PluralMany
+}
+
+// ruleArabic arabic language
+func ruleArabic(n float64) string {
+	if !isInt(n) {
+		return PluralOther
+	}
+	i := int64(n)
+	switch {
+	case i == 0:
+		return PluralZero
+	case i == 1:
+		return PluralOne
+	case i == 2:
+		return PluralTwo
+	case i%100 >= 3 && i%100 <= 10:
+		return PluralFew
+	case i%100 >= 11:
+		return PluralMany
+	}
+	return PluralOther
+}
+
+func init() {
+	for _, lang := range []string{"zh", "ja", "ko", "vi", "th", "id", "ms"} {
+		pluralRules[lang] = ruleOther
+	}
+	for _, lang := range []string{"en", "de", "es", "it", "nl", "sv", "da", "no", "nb", "fi", "el", "hu", "tr", "bg"} {
+		pluralRules[lang] = ruleOneOther
+	}
+	for _, lang := range []string{"fr", "pt"} {
+		pluralRules[lang] = ruleFrench
+	}
+	for _, lang := range []string{"ru", "uk", "be"} {
+		pluralRules[lang] = ruleSlavic
+	}
+	pluralRules["pl"] = rulePolish
+	pluralRules["ar"] = ruleArabic
+}
+
+// RegisterPluralRule register the plural rule of a language, it replaces the built-in rule
+func RegisterPluralRule(lang string, rule PluralRule) {
+	if rule == nil {
+		return
+	}
+	pluralMutex.Lock()
+	defer pluralMutex.Unlock()
+	pluralRules[baseLanguage(lang)] = rule
+}
+
+// pluralCategory get the plural category of n in the language, the english rule is used for unknown languages
+func pluralCategory(lang string, n float64) string {
+	pluralMutex.RLock()
+	rule, ok := pluralRules[baseLanguage(lang)]
+	pluralMutex.RUnlock()
+	if !ok {
+		return ruleOneOther(n)
+	}
+	return rule(n)
+}
+
+// baseLanguage get the base language of a tag, e.g. "zh" of "zh-CN"
+func baseLanguage(lang string) string {
+	lang = normalizeLanguage(lang)
+	if pos := strings.Index(lang, "-"); pos > 0 {
+		return lang[:pos]
+	}
+	return lang
+}
+
+// normalizeLanguage normalize language tag, e.g. "zh_cn" => "zh-cn"
+func normalizeLanguage(lang string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(lang), "_", "-"))
+}
@@ -0,0 +1,60 @@
+package ginx
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PageNegotiator decide whether the page handler should respond json instead of html
+type PageNegotiator func(c *gin.Context) bool
+
+// pageNegotiator the global page negotiator, nil means pages are always rendered as html
+var pageNegotiator PageNegotiator
+
+// UsePageNegotiator register a page negotiator, so that the same PageHandlerFunc can respond Page.Data
+// and Page.Errors as json by the api responser, e.g. ginx.UsePageNegotiator(ginx.DefaultPageNegotiator)
+func UsePageNegotiator(f PageNegotiator) {
+	pageNegotiator = f
+}
+
+// DefaultPageNegotiator respond json if the request is sent by XMLHttpRequest,
+// or the Accept header prefers application/json to text/html
+func DefaultPageNegotiator(c *gin.Context) bool {
+	if strings.EqualFold(c.GetHeader("X-Requested-With"), "XMLHttpRequest") {
+		return true
+	}
+	if c.GetHeader("Accept") == "" {
+		return false
+	}
+	return c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) == gin.MIMEJSON
+}
+
+// addVary add header names to the Vary header of response, names already present are skipped
+func addVary(h http.Header, names ...string) {
+	present := make(map[string]bool)
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			present[strings.ToLower(strings.TrimSpace(name))] = true
+		}
+	}
+	for _, name := range names {
+		if !present[strings.ToLower(name)] {
+			h.Add("Vary", name)
+			present[strings.ToLower(name)] = true
+		}
+	}
+}
+
+// setPageVary set the Vary header by the request headers which decide the representation of pages,
+// so that caches don't serve json or a fragment as the full page
+func setPageVary(c *gin.Context) {
+	h := c.Writer.Header()
+	if pageNegotiator != nil {
+		addVary(h, "Accept", "X-Requested-With")
+	}
+	if fragmentDetector != nil {
+		addVary(h, "HX-Request", "HX-Boosted", "Turbo-Frame")
+	}
+}
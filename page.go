@@ -1,36 +1,66 @@
 package ginx
 
 import (
+	"errors"
 	"fmt"
+	"html/template"
+	"io"
 	"net/http"
 	"net/url"
 	"runtime/debug"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/whencome/ginx/log"
 )
 
 // 定义全局页面初始化方法变量，用于在每次创建Page时进行初始化
 var initPageFunc PageInitFunc = nil
 
-// PageInitFunc 定义一个页面初始化方法，返回map[string]interface{}，返回的数据将放到页面的会话数据（Page.Session）中
+// PageInitFunc 定义一个页面初始化方法，返回map[string]interface{}，返回的数据将放到页面的会话数据（Page.Sess）中
+// Deprecated: Use PageInitializer instead
 type PageInitFunc func() map[string]interface{}
 
+// RegisterPageInitFunc register a global page init func
+// Deprecated: Use UsePageInitializer instead
 func RegisterPageInitFunc(f PageInitFunc) {
 	initPageFunc = f
 }
 
+// ErrPageAborted an initializer returns this error to stop the page handling silently,
+// it's often used when the initializer has already written the response, e.g. a redirect
+var ErrPageAborted = errors.New("page aborted")
+
+// PageInitializer 定义一个与请求相关的页面初始化方法，可以读取当前用户、语言、路径等信息并初始化页面，
+// 返回错误时将中止页面处理
+type PageInitializer func(c *gin.Context, p *Page) error
+
+// pageInitializers global page initializer list
+var pageInitializers = make([]PageInitializer, 0)
+
+// UsePageInitializer register global page initializers, they will be executed in order
+func UsePageInitializer(fs ...PageInitializer) {
+	if len(fs) == 0 {
+		return
+	}
+	pageInitializers = append(pageInitializers, fs...)
+}
+
 // PageError 定义一个页面错误, 用于保存错误以及堆栈信息
 type PageError struct {
-	Message string
-	Trace   string
+	Message string `json:"message"`
+	Trace   string `json:"trace,omitempty"`
 }
 
+// NewPageError create a page error, the stack trace is only recorded in debug mode
 func NewPageError(e error) *PageError {
-	return &PageError{
+	pe := &PageError{
 		Message: e.Error(),
-		Trace:   string(debug.Stack()),
 	}
+	if gin.IsDebugging() {
+		pe.Trace = string(debug.Stack())
+	}
+	return pe
 }
 
 func (pe *PageError) Error() string {
@@ -39,39 +69,49 @@ func (pe *PageError) Error() string {
 
 // Page 定义一个页面数据
 type Page struct {
-	Ctx     *gin.Context
-	view    *View
-	Request Request                // 页面请求数据
-	Params  url.Values             // 请求参数列表
-	Tpl     string                 `json:"tpl"`    // 定义模板
-	Title   string                 `json:"title"`  // 页面标题
-	Data    map[string]interface{} `json:"data"`   // 页面数据，可能会向用户展示
-	Sess    map[string]interface{} `json:"Sess"`   // 保存会话数据，用于服务端业务处理，不对用户展示
-	Errors  []*PageError           `json:"errors"` // 错误列表
+	Ctx      *gin.Context
+	renderer Renderer
+	Request  Request                // 页面请求数据
+	Params   url.Values             // 请求参数列表
+	Tpl      string                 `json:"tpl"`    // 定义模板
+	Status   int                    `json:"status"` // HTTP状态码
+	Title    string                 `json:"title"`  // 页面标题
+	Data     map[string]interface{} `json:"data"`   // 页面数据，可能会向用户展示
+	Sess     map[string]interface{} `json:"Sess"`   // 保存会话数据，用于服务端业务处理，不对用户展示
+	Errors   []*PageError           `json:"errors"` // 错误列表
+	// layout of current page, it overrides the default layout of view if layoutSet is true
+	layout    string
+	layoutSet bool
+	// fragment block to render instead of the full page, it overrides the fragment detector if fragmentSet is true
+	fragment     string
+	fragmentSet  bool
+	oobFragments []string
 }
 
 // NewPage create a Page object
-func NewPage(c *gin.Context, v *View, tpl string) *Page {
+func NewPage(c *gin.Context, r Renderer, tpl string) *Page {
 	p := &Page{
-		Ctx:  c,
-		view: v,
-		Tpl:  tpl,
-		Data: make(map[string]interface{}),
-		Sess: make(map[string]interface{}),
+		Ctx:      c,
+		renderer: r,
+		Tpl:      tpl,
+		Status:   http.StatusOK,
+		Data:     make(map[string]interface{}),
+		Sess:     make(map[string]interface{}),
 	}
 	p.init()
 	return p
 }
 
 // NewPageWithData create a Page object with initialized data
-func NewPageWithData(c *gin.Context, v *View, tpl string, data map[string]interface{}) *Page {
+func NewPageWithData(c *gin.Context, r Renderer, tpl string, data map[string]interface{}) *Page {
 	p := &Page{
-		Ctx:    c,
-		view:   v,
-		Tpl:    tpl,
-		Data:   data,
-		Sess:   make(map[string]interface{}),
-		Errors: make([]*PageError, 0),
+		Ctx:      c,
+		renderer: r,
+		Tpl:      tpl,
+		Status:   http.StatusOK,
+		Data:     data,
+		Sess:     make(map[string]interface{}),
+		Errors:   make([]*PageError, 0),
 	}
 	p.init()
 	return p
@@ -102,6 +142,20 @@ func (p *Page) init() {
 	}
 }
 
+// Initialize execute the registered page initializers in order, it stops at the first error.
+// NewPageHandler calls it automatically before the request is handled.
+func (p *Page) Initialize() error {
+	for _, f := range pageInitializers {
+		if err := f(p.Ctx, p); err != nil {
+			return err
+		}
+		if p.Ctx.IsAborted() {
+			return ErrPageAborted
+		}
+	}
+	return nil
+}
+
 // ContentType get request Content-Type
 func (p *Page) ContentType() string {
 	contentTypes := p.Ctx.Request.Header["Content-Type"]
@@ -122,6 +176,17 @@ func (p *Page) SetTitle(t string) {
 	p.Title = t
 }
 
+// SetLayout set the layout of current page, empty means rendering the page without layout
+func (p *Page) SetLayout(name string) {
+	p.layout = name
+	p.layoutSet = true
+}
+
+// SetStatus set the http status code of page
+func (p *Page) SetStatus(code int) {
+	p.Status = code
+}
+
 // SetData set page data
 func (p *Page) SetData(d map[string]interface{}) {
 	p.Data = d
@@ -161,20 +226,69 @@ func (p *Page) HasError() bool {
 	return false
 }
 
-// Show display page content
+// CSRFToken get csrf token of current session
+func (p *Page) CSRFToken() string {
+	return CSRFToken(p.Ctx)
+}
+
+// CSRFField get a hidden input field which contains the csrf token
+func (p *Page) CSRFField() template.HTML {
+	return CSRFField(p.Ctx)
+}
+
+// WantsJSON check if the client wants a json response instead of html, it's decided by the page negotiator
+func (p *Page) WantsJSON() bool {
+	return pageNegotiator != nil && pageNegotiator(p.Ctx)
+}
+
+// Show display page content, Page.Data or Page.Errors will be responded by the api responser
+// if the client wants json
 func (p *Page) Show() error {
-	return p.view.RenderPage(p.Ctx.Writer, p)
+	setPageVary(p.Ctx)
+	if p.WantsJSON() {
+		if !p.HasError() {
+			getApiResponser().Success(p.Ctx, p.Data)
+		} else if p.Status >= http.StatusBadRequest {
+			getApiResponser().Response(p.Ctx, p.Status, p.Errors)
+		} else {
+			getApiResponser().Fail(p.Ctx, p.Errors)
+		}
+		return nil
+	}
+	return showPage(p.Ctx.Writer, p.renderer, p)
 }
 
-// ShowWithError add error to page and display
+// ShowWithError add error to page and display, the status code is read from ApiError,
+// or http.StatusBadRequest is used if no error status set
 func (p *Page) ShowWithError(e interface{}) error {
+	ae, isApiError := e.(ApiError)
+	if isApiError && ae.Code() >= http.StatusBadRequest && ae.Code() < 600 {
+		p.Status = ae.Code()
+	} else if p.Status < http.StatusBadRequest {
+		p.Status = http.StatusBadRequest
+	}
+	if p.WantsJSON() {
+		setPageVary(p.Ctx)
+		// keep the original ApiError, so that the responser can read the code of it
+		if isApiError {
+			getApiResponser().Fail(p.Ctx, ae)
+		} else {
+			getApiResponser().Response(p.Ctx, p.Status, NewPageError(fmt.Errorf("%s", e)))
+		}
+		return nil
+	}
 	p.AddError(fmt.Errorf("%s", e))
 	return p.Show()
 }
 
-// ShowDirect display page content directly
+// ShowDirect display page content directly, only the page template will be loaded if the renderer is a View
 func (p *Page) ShowDirect() {
-	_ = p.view.ShowDirect(p.Ctx.Writer, p)
+	if v, ok := p.renderer.(*View); ok {
+		setPageVary(p.Ctx)
+		_ = v.ShowDirect(p.Ctx.Writer, p)
+		return
+	}
+	_ = p.Show()
 }
 
 // ShowDirectWithError display page content with error
@@ -182,3 +296,69 @@ func (p *Page) ShowDirectWithError(e interface{}) {
 	p.AddError(fmt.Errorf("%s", e))
 	p.ShowDirect()
 }
+
+// showPage render the page with status code. If rendering failed before anything written, the page is rendered
+// again with the error (the error template is used if configured), and a plain text error is responded
+// if it still fails.
+func showPage(w http.ResponseWriter, r Renderer, p *Page) error {
+	setResponseStatus(w, p.Status)
+	err := r.RenderPage(w, p)
+	if err == nil {
+		return nil
+	}
+	log.Errorf("render page failed: %s", err)
+	if responseWritten(w) {
+		return err
+	}
+	if !p.HasError() {
+		// the template error is shown in debug mode only
+		if gin.IsDebugging() {
+			p.AddError(err)
+		} else {
+			p.AddError(errors.New(http.StatusText(http.StatusInternalServerError)))
+		}
+		p.Status = http.StatusInternalServerError
+		setResponseStatus(w, p.Status)
+		if e := r.RenderPage(w, p); e == nil || responseWritten(w) {
+			return err
+		}
+	}
+	writePlainError(w, p)
+	return err
+}
+
+// setResponseStatus set the status code if the writer supports writing header lazily, such as gin.ResponseWriter
+func setResponseStatus(w http.ResponseWriter, code int) {
+	if gw, ok := w.(gin.ResponseWriter); ok && !gw.Written() {
+		gw.WriteHeader(code)
+	}
+}
+
+// responseWritten check if the response body has been written
+func responseWritten(w http.ResponseWriter) bool {
+	if gw, ok := w.(gin.ResponseWriter); ok {
+		return gw.Size() > 0
+	}
+	return false
+}
+
+// writePlainError respond page errors as plain text, only the status text is responded
+// outside debug mode to avoid leaking internals
+func writePlainError(w http.ResponseWriter, p *Page) {
+	code := p.Status
+	if code < http.StatusBadRequest {
+		code = http.StatusInternalServerError
+	}
+	msg := http.StatusText(code)
+	if gin.IsDebugging() {
+		msgs := make([]string, 0, len(p.Errors))
+		for _, e := range p.Errors {
+			msgs = append(msgs, e.Message)
+		}
+		msg = strings.Join(msgs, "\n")
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Del("Content-Length")
+	w.WriteHeader(code)
+	_, _ = io.WriteString(w, msg)
+}
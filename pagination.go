@@ -0,0 +1,288 @@
+package ginx
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// query params of pagination
+const (
+	PageParam     = "page"
+	PageSizeParam = "page_size"
+	CursorParam   = "cursor"
+)
+
+var (
+	// DefaultPageSize page size used when not specified
+	DefaultPageSize = 20
+	// MaxPageSize the page size requested is limited to it
+	MaxPageSize = 100
+)
+
+// Pagination pagination params of list requests, embed it into the request to support pagination:
+//
+//	type UserListRequest struct {
+//	    ginx.Pagination
+//	    Keyword string `form:"keyword"`
+//	}
+//
+// Both page based (page, page_size) and cursor based (cursor, page_size) pagination are supported,
+// the params are normalized by NewApiHandler and NewPageHandler after binding.
+type Pagination struct {
+	Page     int    `form:"page" json:"page" binding:"omitempty,min=1"`
+	PageSize int    `form:"page_size" json:"page_size" binding:"omitempty,min=1"`
+	Cursor   string `form:"cursor" json:"cursor"`
+}
+
+// PaginatedRequest a request with pagination params, requests embedding Pagination implement it
+type PaginatedRequest interface {
+	GetPagination() *Pagination
+}
+
+// GetPagination get the pagination params
+func (p *Pagination) GetPagination() *Pagination {
+	return p
+}
+
+// Normalize set the default page and page size, the page size is limited to MaxPageSize
+func (p *Pagination) Normalize() {
+	if p.Page < 1 {
+		p.Page = 1
+	}
+	if p.PageSize < 1 {
+		p.PageSize = DefaultPageSize
+	}
+	if MaxPageSize > 0 && p.PageSize > MaxPageSize {
+		p.PageSize = MaxPageSize
+	}
+}
+
+// Offset get the offset of the first item of current page
+func (p *Pagination) Offset() int {
+	if p.Page < 1 {
+		return 0
+	}
+	return (p.Page - 1) * p.Limit()
+}
+
+// Limit get the max number of items of a page
+func (p *Pagination) Limit() int {
+	if p.PageSize < 1 {
+		return DefaultPageSize
+	}
+	return p.PageSize
+}
+
+// normalizePagination normalize the pagination params of the request after binding
+func normalizePagination(req Request) {
+	if pr, ok := req.(PaginatedRequest); ok {
+		pr.GetPagination().Normalize()
+	}
+}
+
+// PageInfo pagination metadata of a paged response. Total and TotalPages are unknown (0) for cursor
+// based pagination, which has a NextCursor instead.
+type PageInfo struct {
+	Total      int64  `json:"total"`
+	Page       int    `json:"page,omitempty"`
+	PageSize   int    `json:"page_size"`
+	TotalPages int    `json:"total_pages,omitempty"`
+	HasNext    bool   `json:"has_next"`
+	HasPrev    bool   `json:"has_prev"`
+	Cursor     string `json:"cursor,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// GetPageInfo get the pagination metadata
+func (pi PageInfo) GetPageInfo() PageInfo {
+	return pi
+}
+
+// PagedResponse a response of paged items, *Paged[T] implements it
+type PagedResponse interface {
+	GetPageInfo() PageInfo
+}
+
+// Paged a page of items with pagination metadata, it's responded as
+// {"items": [...], "total": 100, "page": 1, "page_size": 20, "total_pages": 5, "has_next": true, "has_prev": false}
+type Paged[T any] struct {
+	Items []T `json:"items"`
+	PageInfo
+}
+
+// NewPaged create a page of items by the total count of all items
+func NewPaged[T any](items []T, total int64, p *Pagination) *Paged[T] {
+	p.Normalize()
+	if items == nil {
+		items = make([]T, 0)
+	}
+	totalPages := int((total + int64(p.PageSize) - 1) / int64(p.PageSize))
+	return &Paged[T]{
+		Items: items,
+		PageInfo: PageInfo{
+			Total:      total,
+			Page:       p.Page,
+			PageSize:   p.PageSize,
+			TotalPages: totalPages,
+			HasNext:    p.Page < totalPages,
+			HasPrev:    p.Page > 1,
+		},
+	}
+}
+
+// NewCursorPaged create a page of items by the cursor of next page, empty nextCursor means no more items
+func NewCursorPaged[T any](items []T, nextCursor string, p *Pagination) *Paged[T] {
+	p.Normalize()
+	if items == nil {
+		items = make([]T, 0)
+	}
+	return &Paged[T]{
+		Items: items,
+		PageInfo: PageInfo{
+			PageSize:   p.PageSize,
+			HasNext:    nextCursor != "",
+			HasPrev:    p.Cursor != "",
+			Cursor:     p.Cursor,
+			NextCursor: nextCursor,
+		},
+	}
+}
+
+// pageURL get the url of a page based on the current url, page <= 0 means the page based on cursor
+func pageURL(u *url.URL, pi PageInfo, page int, cursor string) string {
+	q := u.Query()
+	q.Del(PageParam)
+	q.Del(CursorParam)
+	if page > 0 {
+		q.Set(PageParam, strconv.Itoa(page))
+	} else if cursor != "" {
+		q.Set(CursorParam, cursor)
+	}
+	if pi.PageSize > 0 {
+		q.Set(PageSizeParam, strconv.Itoa(pi.PageSize))
+	}
+	nu := *u
+	nu.Scheme = ""
+	nu.Host = ""
+	nu.RawQuery = q.Encode()
+	return nu.String()
+}
+
+// PageLinks get the urls of first, prev, next and last pages based on the current url, keyed by relation
+func PageLinks(u *url.URL, pi PageInfo) map[string]string {
+	links := make(map[string]string)
+	if pi.Page == 0 {
+		// cursor based pagination
+		if pi.HasPrev {
+			links["first"] = pageURL(u, pi, 0, "")
+		}
+		if pi.HasNext {
+			links["next"] = pageURL(u, pi, 0, pi.NextCursor)
+		}
+		return links
+	}
+	if pi.Page > 1 {
+		links["first"] = pageURL(u, pi, 1, "")
+	}
+	if pi.HasPrev {
+		links["prev"] = pageURL(u, pi, pi.Page-1, "")
+	}
+	if pi.HasNext {
+		links["next"] = pageURL(u, pi, pi.Page+1, "")
+	}
+	if pi.TotalPages > 0 && pi.Page < pi.TotalPages {
+		links["last"] = pageURL(u, pi, pi.TotalPages, "")
+	}
+	return links
+}
+
+// SetPageLinks set the RFC 5988 Link header of the paged response, DefaultApiResponser calls it
+// for PagedResponse, custom responsers can call it too
+func SetPageLinks(c *gin.Context, v PagedResponse) {
+	links := PageLinks(c.Request.URL, v.GetPageInfo())
+	values := make([]string, 0, len(links))
+	for _, rel := range []string{"first", "prev", "next", "last"} {
+		if l, ok := links[rel]; ok {
+			values = append(values, fmt.Sprintf(`<%s>; rel="%s"`, l, rel))
+		}
+	}
+	if len(values) > 0 {
+		c.Header("Link", strings.Join(values, ", "))
+	}
+}
+
+// paginationWindow the number of pages shown before and after the current page
+const paginationWindow = 2
+
+// paginate render the page links of paged data, u is the current url, a *Page or a url string,
+// e.g. {{ paginate . .Data.users }}
+func paginate(u interface{}, v PagedResponse) (template.HTML, error) {
+	var cur *url.URL
+	switch t := u.(type) {
+	case *Page:
+		cur = t.Ctx.Request.URL
+	case *url.URL:
+		cur = t
+	case string:
+		var err error
+		if cur, err = url.Parse(t); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("unsupported url %v", u)
+	}
+	if v == nil {
+		return "", nil
+	}
+	pi := v.GetPageInfo()
+	links := PageLinks(cur, pi)
+	if len(links) == 0 {
+		return "", nil
+	}
+	var b strings.Builder
+	b.WriteString(`<nav class="pagination">`)
+	link := func(rel, text string) {
+		if l, ok := links[rel]; ok {
+			fmt.Fprintf(&b, `<a href="%s" rel="%s">%s</a>`, template.HTMLEscapeString(l), rel, text)
+		}
+	}
+	link("prev", "&laquo;")
+	if pi.Page > 0 {
+		start, end := pi.Page-paginationWindow, pi.Page+paginationWindow
+		if start < 1 {
+			start = 1
+		}
+		if end > pi.TotalPages {
+			end = pi.TotalPages
+		}
+		if start > 1 {
+			fmt.Fprintf(&b, `<a href="%s">1</a>`, template.HTMLEscapeString(pageURL(cur, pi, 1, "")))
+			if start > 2 {
+				b.WriteString(`<span class="ellipsis">&hellip;</span>`)
+			}
+		}
+		for i := start; i <= end; i++ {
+			if i == pi.Page {
+				fmt.Fprintf(&b, `<span class="current">%d</span>`, i)
+				continue
+			}
+			fmt.Fprintf(&b, `<a href="%s">%d</a>`, template.HTMLEscapeString(pageURL(cur, pi, i, "")), i)
+		}
+		if end < pi.TotalPages {
+			if end < pi.TotalPages-1 {
+				b.WriteString(`<span class="ellipsis">&hellip;</span>`)
+			}
+			fmt.Fprintf(&b, `<a href="%s">%d</a>`, template.HTMLEscapeString(pageURL(cur, pi, pi.TotalPages, "")), pi.TotalPages)
+		}
+	} else {
+		link("first", "1")
+	}
+	link("next", "&raquo;")
+	b.WriteString(`</nav>`)
+	return template.HTML(b.String()), nil
+}
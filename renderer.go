@@ -0,0 +1,168 @@
+package ginx
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"sync"
+	texttemplate "text/template"
+)
+
+// Renderer render a page to the response, View is the default implementation based on html/template,
+// other template engines can be used by implementing this interface
+type Renderer interface {
+	RenderPage(w http.ResponseWriter, p *Page) error
+}
+
+// templateSet a set of parsed templates, it hides the difference between html/template and text/template
+type templateSet interface {
+	// Parse parse content as a template with the name
+	Parse(name, content string) error
+	// Alias register the parsed template of name under another name as well
+	Alias(name, alias string) error
+	// Defined check if the template of name is defined
+	Defined(name string) bool
+	// Clone clone the template set, it fails if the set has been executed (html/template only)
+	Clone() (templateSet, error)
+	// Funcs add functions to the template set
+	Funcs(m template.FuncMap)
+	// ExecuteTemplate execute the template of name
+	ExecuteTemplate(w io.Writer, name string, v interface{}) error
+}
+
+// newTemplateSet create an empty template set
+func newTemplateSet(text bool) templateSet {
+	if text {
+		return &textTemplateSet{t: texttemplate.New("")}
+	}
+	return &htmlTemplateSet{t: template.New("")}
+}
+
+// htmlTemplateSet a template set of html/template
+type htmlTemplateSet struct {
+	t *template.Template
+}
+
+func (s *htmlTemplateSet) Parse(name, content string) error {
+	_, err := s.t.New(name).Parse(content)
+	return err
+}
+
+func (s *htmlTemplateSet) Alias(name, alias string) error {
+	t := s.t.Lookup(name)
+	if t == nil || t.Tree == nil {
+		return fmt.Errorf("no such template %q", name)
+	}
+	_, err := s.t.AddParseTree(alias, t.Tree)
+	return err
+}
+
+func (s *htmlTemplateSet) Defined(name string) bool {
+	return s.t.Lookup(name) != nil
+}
+
+func (s *htmlTemplateSet) Clone() (templateSet, error) {
+	t, err := s.t.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return &htmlTemplateSet{t: t}, nil
+}
+
+func (s *htmlTemplateSet) Funcs(m template.FuncMap) {
+	s.t.Funcs(m)
+}
+
+func (s *htmlTemplateSet) ExecuteTemplate(w io.Writer, name string, v interface{}) error {
+	return s.t.ExecuteTemplate(w, name, v)
+}
+
+// textTemplateSet a template set of text/template, the output is not escaped
+type textTemplateSet struct {
+	t *texttemplate.Template
+}
+
+func (s *textTemplateSet) Parse(name, content string) error {
+	_, err := s.t.New(name).Parse(content)
+	return err
+}
+
+func (s *textTemplateSet) Alias(name, alias string) error {
+	t := s.t.Lookup(name)
+	if t == nil || t.Tree == nil {
+		return fmt.Errorf("no such template %q", name)
+	}
+	_, err := s.t.AddParseTree(alias, t.Tree)
+	return err
+}
+
+func (s *textTemplateSet) Defined(name string) bool {
+	return s.t.Lookup(name) != nil
+}
+
+func (s *textTemplateSet) Clone() (templateSet, error) {
+	t, err := s.t.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return &textTemplateSet{t: t}, nil
+}
+
+func (s *textTemplateSet) Funcs(m template.FuncMap) {
+	s.t.Funcs(m)
+}
+
+func (s *textTemplateSet) ExecuteTemplate(w io.Writer, name string, v interface{}) error {
+	return s.t.ExecuteTemplate(w, name, v)
+}
+
+// cachedTemplateSet a parsed template set kept in the view cache. The parsed set is never executed,
+// so that it can always be cloned, pages are rendered by executable copies of it which are reused
+// by a pool. It's necessary because html/template can't be cloned once executed, while page functions
+// have to be bound to each copy before executing.
+type cachedTemplateSet struct {
+	templateSet
+	copies sync.Pool
+}
+
+// newCachedTemplateSet wrap the parsed template set for caching
+func newCachedTemplateSet(t templateSet) *cachedTemplateSet {
+	return &cachedTemplateSet{templateSet: t}
+}
+
+// get get an executable copy of the template set, it should be released by put after executed
+func (s *cachedTemplateSet) get() (templateSet, error) {
+	if t, ok := s.copies.Get().(templateSet); ok {
+		return t, nil
+	}
+	return s.templateSet.Clone()
+}
+
+// put release the copy to the pool
+func (s *cachedTemplateSet) put(t templateSet) {
+	s.copies.Put(t)
+}
+
+// NewTextView create a view based on text/template, it's used to render plain text such as emails,
+// the output is not escaped. It supports all options of View.
+func NewTextView(options ...ViewOption) *View {
+	opts := make([]ViewOption, 0, len(options)+3)
+	opts = append(opts, WithTplExtension(".txt"), WithContentType("text/plain; charset=utf-8"), withTextTemplate())
+	opts = append(opts, options...)
+	return NewView(opts...)
+}
+
+// withTextTemplate use text/template instead of html/template
+func withTextTemplate() ViewOption {
+	return func(view *View) {
+		view.textTemplate = true
+	}
+}
+
+// WithContentType set the Content-Type of rendered response
+func WithContentType(ct string) ViewOption {
+	return func(view *View) {
+		view.contentType = ct
+	}
+}
@@ -0,0 +1,169 @@
+package ginx
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Router a router knows its base path, both *gin.Engine and *gin.RouterGroup implement it
+type Router interface {
+	gin.IRoutes
+	BasePath() string
+}
+
+var (
+	// namedRoutes route name => full path pattern, e.g. "user.show" => "/v1/users/:id"
+	namedRoutes = make(map[string]string)
+	routeMutex  sync.RWMutex
+)
+
+// joinPaths join the base path and relative path, keeps the trailing slash like gin
+func joinPaths(absolutePath, relativePath string) string {
+	if relativePath == "" {
+		return absolutePath
+	}
+	finalPath := path.Join(absolutePath, relativePath)
+	if strings.HasSuffix(relativePath, "/") && !strings.HasSuffix(finalPath, "/") {
+		return finalPath + "/"
+	}
+	return finalPath
+}
+
+// NameRoute give a name to the route of router, the full path includes the prefixes of all
+// parent groups, so it's still correct after the group or bucket is remounted.
+// It panics if the name is already used by another path.
+func NameRoute(r Router, name, relativePath string) {
+	if name == "" {
+		return
+	}
+	fullPath := joinPaths(r.BasePath(), relativePath)
+	routeMutex.Lock()
+	defer routeMutex.Unlock()
+	if p, ok := namedRoutes[name]; ok && p != fullPath {
+		panic(fmt.Sprintf("route name '%s' is already used by '%s'", name, p))
+	}
+	namedRoutes[name] = fullPath
+}
+
+// Handle register a route with name, the name can be empty
+func Handle(r Router, name, method, relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	NameRoute(r, name, relativePath)
+	return r.Handle(method, relativePath, handlers...)
+}
+
+// GET register a GET route with name
+func GET(r Router, name, relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return Handle(r, name, http.MethodGet, relativePath, handlers...)
+}
+
+// POST register a POST route with name
+func POST(r Router, name, relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return Handle(r, name, http.MethodPost, relativePath, handlers...)
+}
+
+// PUT register a PUT route with name
+func PUT(r Router, name, relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return Handle(r, name, http.MethodPut, relativePath, handlers...)
+}
+
+// PATCH register a PATCH route with name
+func PATCH(r Router, name, relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return Handle(r, name, http.MethodPatch, relativePath, handlers...)
+}
+
+// DELETE register a DELETE route with name
+func DELETE(r Router, name, relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return Handle(r, name, http.MethodDelete, relativePath, handlers...)
+}
+
+// RoutePath get the full path pattern of a named route
+func RoutePath(name string) (string, bool) {
+	routeMutex.RLock()
+	defer routeMutex.RUnlock()
+	p, ok := namedRoutes[name]
+	return p, ok
+}
+
+// URLFor build the url of a named route, params are key/value pairs or a map, the path params
+// (":id" or "*path") are replaced by the params with the same name, other params are added to query string.
+// e.g. URLFor("user.show", "id", 1, "tab", "posts") => "/v1/users/1?tab=posts"
+func URLFor(name string, params ...interface{}) (string, error) {
+	pattern, ok := RoutePath(name)
+	if !ok {
+		return "", fmt.Errorf("route '%s' not found", name)
+	}
+	values := make(map[string]string)
+	keys := make([]string, 0)
+	for i := 0; i < len(params); i++ {
+		switch p := params[i].(type) {
+		case map[string]interface{}:
+			for k, v := range p {
+				keys = append(keys, k)
+				values[k] = fmt.Sprint(v)
+			}
+		case map[string]string:
+			for k, v := range p {
+				keys = append(keys, k)
+				values[k] = v
+			}
+		default:
+			if i+1 >= len(params) {
+				return "", fmt.Errorf("missing value of route param %v", p)
+			}
+			k := fmt.Sprint(p)
+			keys = append(keys, k)
+			values[k] = fmt.Sprint(params[i+1])
+			i++
+		}
+	}
+	used := make(map[string]bool)
+	segments := strings.Split(pattern, "/")
+	for i, seg := range segments {
+		if len(seg) < 2 || (seg[0] != ':' && seg[0] != '*') {
+			continue
+		}
+		k := seg[1:]
+		v, ok := values[k]
+		if !ok {
+			return "", fmt.Errorf("missing param '%s' of route '%s'", k, name)
+		}
+		used[k] = true
+		if seg[0] == ':' {
+			segments[i] = url.PathEscape(v)
+			continue
+		}
+		// wildcard param may contain slashes
+		parts := strings.Split(strings.TrimPrefix(v, "/"), "/")
+		for j := range parts {
+			parts[j] = url.PathEscape(parts[j])
+		}
+		segments[i] = strings.Join(parts, "/")
+	}
+	u := strings.Join(segments, "/")
+	query := url.Values{}
+	for _, k := range keys {
+		if !used[k] {
+			query.Set(k, values[k])
+		}
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u, nil
+}
+
+// RedirectToRoute redirect to the url of a named route
+func RedirectToRoute(c *gin.Context, code int, name string, params ...interface{}) error {
+	u, err := URLFor(name, params...)
+	if err != nil {
+		return err
+	}
+	c.Redirect(code, u)
+	return nil
+}
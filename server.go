@@ -2,16 +2,22 @@ package ginx
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/whencome/ginx/log"
+	"golang.org/x/net/http2"
 )
 
 // define gin run mode constant
@@ -21,38 +27,110 @@ const (
 	ModeRelease = "release"
 )
 
+// defaultShutdownTimeout max duration of graceful shutdown when ShutdownTimeout is not set
+const defaultShutdownTimeout = 15 * time.Second
+
 // ServerOptions http server run options
 type ServerOptions struct {
-	Port     int    `json:"port" yaml:"port" toml:"port"`                // server port
-	Mode     string `json:"mode" yaml:"mode" toml:"mode"`                // run mode, debug or release
-	Tls      bool   `json:"tls" yaml:"tls" toml:"tls"`                   // enable HTTPS
-	CertFile string `json:"cert_file" yaml:"cert_file" toml:"cert_file"` // certificate file
-	KeyFile  string `json:"key_file" yaml:"key_file" toml:"key_file"`    // key file
+	Host     string `json:"host" yaml:"host" toml:"host"`                                                           // bind host, empty means all interfaces
+	Port     int    `json:"port" yaml:"port" toml:"port" binding:"min=0,max=65535" label:"port"`                    // server port
+	Mode     string `json:"mode" yaml:"mode" toml:"mode" binding:"omitempty,oneof=debug release test" label:"mode"` // run mode, debug or release
+	Tls      bool   `json:"tls" yaml:"tls" toml:"tls"`                                                              // enable HTTPS
+	CertFile string `json:"cert_file" yaml:"cert_file" toml:"cert_file"`                                            // certificate file
+	KeyFile  string `json:"key_file" yaml:"key_file" toml:"key_file"`                                               // key file
+	// tls settings
+	TLSMinVersion      string        `json:"tls_min_version" yaml:"tls_min_version" toml:"tls_min_version" binding:"omitempty,oneof=1.0 1.1 1.2 1.3 tls1.0 tls1.1 tls1.2 tls1.3 TLS1.0 TLS1.1 TLS1.2 TLS1.3" label:"tls_min_version"` // minimum tls version: 1.0, 1.1, 1.2 or 1.3 (or tls1.2 etc.), it never lowers TLSConfig.MinVersion
+	TLSCipherSuites    []string      `json:"tls_cipher_suites" yaml:"tls_cipher_suites" toml:"tls_cipher_suites"`                                                                                                                     // cipher suites of tls 1.0-1.2, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+	ClientCAFile       string        `json:"client_ca_file" yaml:"client_ca_file" toml:"client_ca_file"`                                                                                                                              // CA bundle to verify client certificates (mTLS)
+	ClientAuth         string        `json:"client_auth" yaml:"client_auth" toml:"client_auth" binding:"omitempty,oneof=none request require verify_if_given require_and_verify" label:"client_auth"`                                 // none, request, require, verify_if_given or require_and_verify (default with ClientCAFile)
+	CertReloadInterval time.Duration `json:"cert_reload_interval" yaml:"cert_reload_interval" toml:"cert_reload_interval"`                                                                                                            // interval to check certificate changes, zero means no reloading
+	TLSConfig          *tls.Config   `json:"-" yaml:"-" toml:"-"`                                                                                                                                                                     // base tls config, the options above are applied to a clone of it
+	// http/2 and http/3
+	H2C         bool          `json:"h2c" yaml:"h2c" toml:"h2c"`                                                                   // serve http/2 cleartext (prior knowledge or upgrade) on plain http listeners
+	HTTP2       *HTTP2Options `json:"http2" yaml:"http2" toml:"http2"`                                                             // tuning of http/2, nil means the defaults of net/http
+	HTTP3Port   int           `json:"http3_port" yaml:"http3_port" toml:"http3_port" binding:"min=0,max=65535" label:"http3_port"` // udp port of http/3, Port is used if zero
+	HTTP3Server HTTP3Server   `json:"-" yaml:"-" toml:"-"`                                                                         // http/3 implementation, http/3 is served alongside https if set
+	// listeners, the server listens on Host:Port by default
+	UnixSocket       string      `json:"unix_socket" yaml:"unix_socket" toml:"unix_socket"`                                       // listen on the unix domain socket instead of Host:Port
+	UnixSocketMode   os.FileMode `json:"unix_socket_mode" yaml:"unix_socket_mode" toml:"unix_socket_mode"`                        // permissions of the unix socket, e.g. 0660
+	SocketActivation bool        `json:"socket_activation" yaml:"socket_activation" toml:"socket_activation"`                     // use listeners passed by systemd (LISTEN_FDS) if present
+	HTTPPort         int         `json:"http_port" yaml:"http_port" toml:"http_port" binding:"min=0,max=65535" label:"http_port"` // also listen plain http on Host:HTTPPort when Tls is enabled
+	RedirectHTTP     bool        `json:"redirect_http" yaml:"redirect_http" toml:"redirect_http"`                                 // redirect requests of HTTPPort to https instead of serving them
+	// timeouts and limits of http server, zero means no limit
+	ReadTimeout       time.Duration `json:"read_timeout" yaml:"read_timeout" toml:"read_timeout"`                      // max duration of reading the entire request
+	ReadHeaderTimeout time.Duration `json:"read_header_timeout" yaml:"read_header_timeout" toml:"read_header_timeout"` // max duration of reading request headers
+	WriteTimeout      time.Duration `json:"write_timeout" yaml:"write_timeout" toml:"write_timeout"`                   // max duration before timing out writes of the response
+	IdleTimeout       time.Duration `json:"idle_timeout" yaml:"idle_timeout" toml:"idle_timeout"`                      // max duration to wait for the next request when keep-alives are enabled
+	MaxHeaderBytes    int           `json:"max_header_bytes" yaml:"max_header_bytes" toml:"max_header_bytes"`          // max bytes of request headers
+	MaxBodyBytes      int64         `json:"max_body_bytes" yaml:"max_body_bytes" toml:"max_body_bytes"`                // max bytes of request body
+	// graceful shutdown
+	ShutdownTimeout time.Duration `json:"shutdown_timeout" yaml:"shutdown_timeout" toml:"shutdown_timeout"` // max duration of waiting for active connections, 15s if zero, negative means no limit
+	ShutdownDelay   time.Duration `json:"shutdown_delay" yaml:"shutdown_delay" toml:"shutdown_delay"`       // delay after marked not ready and before shutdown, e.g. for load balancer deregistration
+	ForceClose      bool          `json:"force_close" yaml:"force_close" toml:"force_close"`                // close active connections forcibly if shutdown timed out
+	// graceful restart, not supported on windows
+	RestartSignal  string        `json:"restart_signal" yaml:"restart_signal" toml:"restart_signal"`    // signal to restart gracefully, SIGHUP or SIGUSR2, empty means stopping on SIGHUP
+	RestartTimeout time.Duration `json:"restart_timeout" yaml:"restart_timeout" toml:"restart_timeout"` // max duration of waiting for the new process to be ready
+	// health endpoints, empty path means not mounted
+	LivenessPath       string        `json:"liveness_path" yaml:"liveness_path" toml:"liveness_path"`                      // path of liveness endpoint, e.g. /livez
+	ReadinessPath      string        `json:"readiness_path" yaml:"readiness_path" toml:"readiness_path"`                   // path of readiness endpoint, e.g. /readyz
+	HealthCheckTimeout time.Duration `json:"health_check_timeout" yaml:"health_check_timeout" toml:"health_check_timeout"` // default timeout of each health check
 }
 
-// ServerHookFunc http server init & stop hooks
+// ServerHookFunc a hook of http server lifecycle
 type ServerHookFunc func(r *gin.Engine) error
 
 // DefaultServerOptions create default options
 func DefaultServerOptions() *ServerOptions {
 	return &ServerOptions{
-		Port: 8080,
-		Mode: ModeRelease,
-		Tls:  false,
+		Port:               8080,
+		Mode:               ModeRelease,
+		Tls:                false,
+		TLSMinVersion:      "1.2",
+		ReadTimeout:        30 * time.Second,
+		ReadHeaderTimeout:  10 * time.Second,
+		WriteTimeout:       60 * time.Second,
+		IdleTimeout:        120 * time.Second,
+		MaxHeaderBytes:     1 << 20,
+		MaxBodyBytes:       10 << 20,
+		ShutdownTimeout:    defaultShutdownTimeout,
+		ShutdownDelay:      0,
+		ForceClose:         true,
+		RestartSignal:      "SIGHUP",
+		RestartTimeout:     30 * time.Second,
+		HealthCheckTimeout: 5 * time.Second,
 	}
 }
 
 // HTTPServer define a simple http server
 type HTTPServer struct {
 	running bool
+	// ready whether the server is ready to accept requests, it turns false before shutdown
+	ready   atomic.Bool
 	engine  *gin.Engine
 	svr     *http.Server
 	options *ServerOptions
-	// hooks of init server
-	postInitFunc ServerHookFunc
-	// hooks of stop server
-	preStopFunc  ServerHookFunc
-	postStopFunc ServerHookFunc
+	// hooks of server lifecycle by phase
+	hooks map[HookPhase][]ServerHook
+	// health checks of readiness and liveness endpoints
+	health *HealthChecker
+	// views to precompile before server start
+	views []*View
+	// server redirecting plain http requests to https
+	redirectSvr *http.Server
+	// certificate reloader of https server
+	certReloader *certReloader
+	// http/2 server, nil means the defaults of net/http
+	h2s *http2.Server
+	// listeners being served
+	listeners []*serverListener
+	// udp connection of http/3
+	packetConn net.PacketConn
+	// Alt-Svc header advertising http/3
+	altSvc atomic.Pointer[string]
+	// done is closed when serving ended, serveErr is the error ended it
+	done     chan struct{}
+	serveErr error
+	errOnce  sync.Once
 }
 
 // NewServer create a http server
@@ -75,35 +153,55 @@ func NewServer(options *ServerOptions) *HTTPServer {
 		engine:  gin.Default(),
 		svr:     nil,
 		options: options,
+		health:  NewHealthChecker(options.HealthCheckTimeout),
 	}
+	s.mountHealthEndpoints()
 	s.svr = &http.Server{
-		Addr:    fmt.Sprintf(":%d", options.Port),
-		Handler: s.engine,
+		Addr:              net.JoinHostPort(options.Host, strconv.Itoa(options.Port)),
+		Handler:           s.handler(),
+		ReadTimeout:       options.ReadTimeout,
+		ReadHeaderTimeout: options.ReadHeaderTimeout,
+		WriteTimeout:      options.WriteTimeout,
+		IdleTimeout:       options.IdleTimeout,
+		MaxHeaderBytes:    options.MaxHeaderBytes,
 	}
 	return s
 }
 
-func (s *HTTPServer) GinEngine() *gin.Engine {
-	return s.engine
-}
-
-func (s *HTTPServer) PostInit(f ServerHookFunc) {
-	s.postInitFunc = f
+// maxBodyHandler limit the size of request body, requests with larger Content-Length are rejected
+// with http.StatusRequestEntityTooLarge, reading beyond the limit fails otherwise
+func maxBodyHandler(h http.Handler, n int64) http.Handler {
+	if n <= 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > n {
+			w.Header().Set("Connection", "close")
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, n)
+		h.ServeHTTP(w, r)
+	})
 }
 
-func (s *HTTPServer) PreStop(f ServerHookFunc) {
-	s.preStopFunc = f
+func (s *HTTPServer) GinEngine() *gin.Engine {
+	return s.engine
 }
 
-func (s *HTTPServer) PostStop(f ServerHookFunc) {
-	s.postStopFunc = f
+// RegisterView register views which will be precompiled before the server starts, so that
+// template errors fail the startup. It can be called in the PostInit hook.
+func (s *HTTPServer) RegisterView(views ...*View) {
+	for _, v := range views {
+		if v != nil {
+			s.views = append(s.views, v)
+		}
+	}
 }
 
-func (s *HTTPServer) execHook(f ServerHookFunc) error {
-	if f == nil {
-		return nil
-	}
-	return f(s.engine)
+// Ready check whether the server is ready to serve requests, it's false before started and once stopping
+func (s *HTTPServer) Ready() bool {
+	return s.ready.Load()
 }
 
 // Runnable check whether server is runnable
@@ -115,29 +213,29 @@ func (s *HTTPServer) prepare() error {
 	if !s.Runnable() {
 		return errors.New("http server not runnable, it has probably already started")
 	}
-	if e := s.execHook(s.postInitFunc); e != nil {
+	if e := s.runHooks(PhasePostInit); e != nil {
 		return e
 	}
-	return nil
+	for _, v := range s.views {
+		if e := v.Precompile(); e != nil {
+			return fmt.Errorf("precompile templates failed:\n%w", e)
+		}
+	}
+	return s.runHooks(PhasePreStart)
 }
 
-// Run start http server in block mode
+// Run start http server in block mode, it returns when the server stopped,
+// the error is nil if the server is stopped gracefully
 func (s *HTTPServer) Run() error {
-	// prepare server
-	e := s.prepare()
-	if e != nil {
-		return e
+	if _, err := s.Start(); err != nil {
+		return err
 	}
-
-	// start http service
-	s.running = true
-	if s.options.Tls {
-		return s.svr.ListenAndServeTLS(s.options.CertFile, s.options.KeyFile)
-	}
-	return s.svr.ListenAndServe()
+	<-s.Done()
+	return s.Err()
 }
 
-// Start start http server in non-blocked mode
+// Start start http server in non-blocked mode, the listener is bound before it returns,
+// so errors such as port conflicts are returned immediately
 func (s *HTTPServer) Start() (bool, error) {
 	// prepare server
 	e := s.prepare()
@@ -145,64 +243,223 @@ func (s *HTTPServer) Start() (bool, error) {
 		return false, e
 	}
 
-	// start http service in non-blocking mode
+	lns, err := s.listen()
+	if err != nil {
+		return false, err
+	}
+	s.serve(lns)
+	s.started()
+	return true, nil
+}
+
+// Serve serve on the listener in block mode, https is served if Tls is enabled,
+// it returns when the server stopped
+func (s *HTTPServer) Serve(ln net.Listener) error {
+	if err := s.prepare(); err != nil {
+		return err
+	}
+	if err := s.setupTLS(); err != nil {
+		return err
+	}
+	s.serve([]*serverListener{{Listener: ln, tls: s.options.Tls}})
+	s.started()
+	<-s.Done()
+	return s.Err()
+}
+
+// started run the OnReady hooks after serving started, errors are logged only
+func (s *HTTPServer) started() {
+	log.Infof("http server started on %s", s.Addr())
+	if err := s.runHooks(PhaseOnReady); err != nil {
+		log.Errorf("%s", err)
+	}
+	// tell the parent process the server is ready when started by graceful restart
+	notifyReady()
+}
+
+// serve start serving on the listeners in background, Done is closed when serving ended
+func (s *HTTPServer) serve(lns []*serverListener) {
+	s.listeners = lns
+	s.done = make(chan struct{})
+	s.serveErr = nil
+	s.errOnce = sync.Once{}
 	s.running = true
-	startCh := make(chan error)
-	go func() {
-		if s.options.Tls {
-			if err := s.svr.ListenAndServeTLS(s.options.CertFile, s.options.KeyFile); err != nil {
-				startCh <- err
+	s.ready.Store(true)
+	if s.certReloader != nil && s.options.CertReloadInterval > 0 {
+		go s.certReloader.watch(s.options.CertReloadInterval)
+	}
+	// the redirect server is created before serving, so that Stop always sees it
+	s.redirectSvr = nil
+	for _, ln := range lns {
+		if ln.redirect {
+			s.redirectSvr = s.newRedirectServer()
+			break
+		}
+	}
+	wg := sync.WaitGroup{}
+	for _, ln := range lns {
+		wg.Add(1)
+		go func(ln *serverListener) {
+			defer wg.Done()
+			var err error
+			switch {
+			case ln.redirect:
+				err = s.redirectSvr.Serve(ln)
+			case ln.tls:
+				// certificates are provided by s.svr.TLSConfig
+				err = s.svr.ServeTLS(ln, "", "")
+			default:
+				err = s.svr.Serve(ln)
 			}
-		} else {
-			if err := s.svr.ListenAndServe(); err != nil {
-				startCh <- err
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Errorf("serve on %s failed: %s", ln.Addr(), err)
+				s.errOnce.Do(func() {
+					s.serveErr = err
+				})
 			}
-		}
+		}(ln)
+	}
+	if pc := s.packetConn; pc != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.serveHTTP3(pc); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Errorf("serve http/3 on %s failed: %s", pc.LocalAddr(), err)
+				s.errOnce.Do(func() {
+					s.serveErr = err
+				})
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		s.ready.Store(false)
+		close(s.done)
 	}()
+}
 
+// Addr get the address the server is listening on, e.g. "[::]:8080", the first one is returned if listening
+// on multiple addresses. It's useful to get the actual port when started with port 0.
+// The configured address is returned before started.
+func (s *HTTPServer) Addr() string {
+	if len(s.listeners) > 0 {
+		return s.listeners[0].Addr().String()
+	}
+	return s.svr.Addr
+}
+
+// Done get a channel which is closed when the server stopped serving, it's nil before started
+func (s *HTTPServer) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err get the error which ended the server, it's nil if the server is still running or stopped gracefully
+func (s *HTTPServer) Err() error {
+	if s.done == nil {
+		return nil
+	}
 	select {
-	case err := <-startCh:
-		return false, err
-	case <-time.After(time.Second * 3):
-		log.Infof("http server started on %s", s.svr.Addr)
-		return true, nil
+	case <-s.done:
+		return s.serveErr
+	default:
+		return nil
 	}
 }
 
-// Stop the server with graceful shutdown
-func (s *HTTPServer) Stop() {
-	// exec pre stop hook
-	err := s.execHook(s.preStopFunc)
-	if err != nil {
-		log.Errorf("prepare stop server failed: %s", err)
+// Stop the server with graceful shutdown. The server is marked not ready first, and it waits for
+// ShutdownDelay before shutting down, then active connections are drained within ShutdownTimeout.
+// Errors of hooks and shutdown are all returned.
+func (s *HTTPServer) Stop() error {
+	if !s.running {
+		return errors.New("http server is not running")
+	}
+	errs := make([]error, 0)
+	s.ready.Store(false)
+	// exec pre stop hooks
+	if err := s.runHooks(PhasePreStop); err != nil {
+		errs = append(errs, fmt.Errorf("prepare stop server failed: %w", err))
+	}
+	// wait for load balancers to stop sending new requests
+	if s.options.ShutdownDelay > 0 {
+		log.Infof("wait %s before shutdown", s.options.ShutdownDelay)
+		time.Sleep(s.options.ShutdownDelay)
 	}
 	// shutdown the http server with timeout
 	log.Infof("start to shutdown http server")
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
-	if err = s.svr.Shutdown(ctx); err != nil {
-		log.Errorf("shutdown server: %s", err)
-		return
+	ctx := context.Background()
+	timeout := s.options.ShutdownTimeout
+	if timeout == 0 {
+		timeout = defaultShutdownTimeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if s.redirectSvr != nil {
+		if err := s.redirectSvr.Shutdown(ctx); err != nil {
+			_ = s.redirectSvr.Close()
+		}
+	}
+	if s.packetConn != nil {
+		if err := s.options.HTTP3Server.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("shutdown http/3 server failed: %w", err))
+		}
+		_ = s.packetConn.Close()
+		s.packetConn = nil
+		s.altSvc.Store(nil)
+	}
+	// the listeners are closed even if shutdown failed, so the server is always cleaned up below,
+	// active connections are left to finish by themselves unless ForceClose is set
+	if err := s.svr.Shutdown(ctx); err != nil {
+		if !errors.Is(err, context.DeadlineExceeded) || !s.options.ForceClose {
+			errs = append(errs, fmt.Errorf("shutdown server failed: %w", err))
+		} else {
+			log.Errorf("shutdown server timed out, close active connections forcibly")
+			if err = s.svr.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("close server failed: %w", err))
+			}
+		}
+	}
+	if s.done != nil {
+		<-s.done
+	}
+	if s.certReloader != nil {
+		s.certReloader.Close()
+		s.certReloader = nil
 	}
 	s.running = false
-	// exec post stop hook
-	err = s.execHook(s.postStopFunc)
-	if err != nil {
-		log.Errorf("stop server: %s", err)
+	// exec post stop hooks
+	if err := s.runHooks(PhasePostStop); err != nil {
+		errs = append(errs, fmt.Errorf("stop server failed: %w", err))
 	}
 	log.Infof("http server closed")
+	return errors.Join(errs...)
 }
 
-// Wait block and wait for exit signal
-func (s *HTTPServer) Wait() {
+// Wait block and wait for exit signal, then stop the server. When the restart signal is received,
+// a new process is started to take over the listeners, and the server stops after it's ready.
+func (s *HTTPServer) Wait() error {
+	restartSig := lookupSignal(s.options.RestartSignal)
+	sigs := []os.Signal{syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT}
+	if restartSig != nil {
+		sigs = append(sigs, restartSig)
+	}
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT)
-	sig := <-sigChan
-	switch sig {
-	case syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP:
-		log.Infof("received exit signal: %v", sig)
-		s.Stop()
-		time.Sleep(1 * time.Second)
-		return
+	signal.Notify(sigChan, sigs...)
+	defer signal.Stop(sigChan)
+	for {
+		sig := <-sigChan
+		if restartSig != nil && sig == restartSig {
+			log.Infof("received restart signal: %v", sig)
+			if err := s.Restart(); err != nil {
+				log.Errorf("restart server failed: %s", err)
+				continue
+			}
+		} else {
+			log.Infof("received exit signal: %v", sig)
+		}
+		err := s.runHooks(PhaseOnShutdownSignal)
+		return errors.Join(err, s.Stop())
 	}
 }
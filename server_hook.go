@@ -0,0 +1,146 @@
+package ginx
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/whencome/ginx/log"
+)
+
+// HookPhase a phase of server lifecycle to run hooks
+type HookPhase string
+
+// phases of server lifecycle, in the order they run
+const (
+	PhasePostInit         HookPhase = "post_init"          // before templates precompiled, e.g. registering routes
+	PhasePreStart         HookPhase = "pre_start"          // before listening
+	PhaseOnReady          HookPhase = "on_ready"           // after the server is serving
+	PhaseOnShutdownSignal HookPhase = "on_shutdown_signal" // an exit or restart signal is received by Wait
+	PhasePreStop          HookPhase = "pre_stop"           // before shutdown, hooks run in reverse order
+	PhasePostStop         HookPhase = "post_stop"          // after shutdown, hooks run in reverse order
+)
+
+// ServerHook a named hook of server lifecycle
+type ServerHook struct {
+	Name    string         // name used in logs and errors, "<phase>#<n>" if empty
+	Func    ServerHookFunc // the hook function
+	Timeout time.Duration  // max duration of the hook, zero means no limit
+}
+
+// HookOption set options of a hook
+type HookOption func(h *ServerHook)
+
+// WithHookName set the name of hook
+func WithHookName(name string) HookOption {
+	return func(h *ServerHook) {
+		h.Name = name
+	}
+}
+
+// WithHookTimeout set the timeout of hook, the hook fails if it's not finished in time
+func WithHookTimeout(d time.Duration) HookOption {
+	return func(h *ServerHook) {
+		h.Timeout = d
+	}
+}
+
+// AddHook append a hook of the phase, hooks of a phase run in the order they were added,
+// except for PhasePreStop and PhasePostStop, which run in reverse order
+func (s *HTTPServer) AddHook(phase HookPhase, f ServerHookFunc, opts ...HookOption) {
+	if f == nil {
+		return
+	}
+	h := ServerHook{Func: f}
+	for _, o := range opts {
+		o(&h)
+	}
+	if h.Name == "" {
+		h.Name = fmt.Sprintf("%s#%d", phase, len(s.hooks[phase])+1)
+	}
+	if s.hooks == nil {
+		s.hooks = make(map[HookPhase][]ServerHook)
+	}
+	s.hooks[phase] = append(s.hooks[phase], h)
+}
+
+// PostInit add a hook which runs before the server starts, it's used to register routes and init resources
+func (s *HTTPServer) PostInit(f ServerHookFunc, opts ...HookOption) {
+	s.AddHook(PhasePostInit, f, opts...)
+}
+
+// PreStart add a hook which runs after templates precompiled and before listening
+func (s *HTTPServer) PreStart(f ServerHookFunc, opts ...HookOption) {
+	s.AddHook(PhasePreStart, f, opts...)
+}
+
+// OnReady add a hook which runs after the server is serving, errors are logged only
+func (s *HTTPServer) OnReady(f ServerHookFunc, opts ...HookOption) {
+	s.AddHook(PhaseOnReady, f, opts...)
+}
+
+// OnShutdownSignal add a hook which runs when Wait receives an exit or restart signal, before the server stops
+func (s *HTTPServer) OnShutdownSignal(f ServerHookFunc, opts ...HookOption) {
+	s.AddHook(PhaseOnShutdownSignal, f, opts...)
+}
+
+// PreStop add a hook which runs before shutdown
+func (s *HTTPServer) PreStop(f ServerHookFunc, opts ...HookOption) {
+	s.AddHook(PhasePreStop, f, opts...)
+}
+
+// PostStop add a hook which runs after shutdown
+func (s *HTTPServer) PostStop(f ServerHookFunc, opts ...HookOption) {
+	s.AddHook(PhasePostStop, f, opts...)
+}
+
+// runHooks run the hooks of phase. Hooks of PhasePostInit and PhasePreStart stop at the first error
+// since the server can't start, hooks of other phases all run and the errors are joined.
+func (s *HTTPServer) runHooks(phase HookPhase) error {
+	hooks := s.hooks[phase]
+	failFast := phase == PhasePostInit || phase == PhasePreStart
+	reverse := phase == PhasePreStop || phase == PhasePostStop
+	errs := make([]error, 0)
+	for i := range hooks {
+		h := hooks[i]
+		if reverse {
+			h = hooks[len(hooks)-1-i]
+		}
+		if err := s.runHook(h); err != nil {
+			err = fmt.Errorf("hook %s failed: %w", h.Name, err)
+			if failFast {
+				return err
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runHook run the hook with timeout, the hook keeps running in background after timed out
+func (s *HTTPServer) runHook(h ServerHook) (err error) {
+	log.Debugf("run hook %s", h.Name)
+	if h.Timeout <= 0 {
+		return s.callHook(h)
+	}
+	result := make(chan error, 1)
+	go func() {
+		result <- s.callHook(h)
+	}()
+	select {
+	case err = <-result:
+		return err
+	case <-time.After(h.Timeout):
+		return fmt.Errorf("timed out after %s", h.Timeout)
+	}
+}
+
+// callHook call the hook function, panics are recovered as errors
+func (s *HTTPServer) callHook(h ServerHook) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h.Func(s.engine)
+}
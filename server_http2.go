@@ -0,0 +1,120 @@
+package ginx
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// HTTP2Options tuning of http/2, zero values mean the defaults of golang.org/x/net/http2
+type HTTP2Options struct {
+	MaxConcurrentStreams         uint32        `json:"max_concurrent_streams" yaml:"max_concurrent_streams" toml:"max_concurrent_streams"`                               // max concurrent streams of a connection
+	MaxReadFrameSize             uint32        `json:"max_read_frame_size" yaml:"max_read_frame_size" toml:"max_read_frame_size"`                                        // max frame size the server reads
+	IdleTimeout                  time.Duration `json:"idle_timeout" yaml:"idle_timeout" toml:"idle_timeout"`                                                             // close idle connections after the duration
+	MaxUploadBufferPerConnection int32         `json:"max_upload_buffer_per_connection" yaml:"max_upload_buffer_per_connection" toml:"max_upload_buffer_per_connection"` // flow control window of a connection
+	MaxUploadBufferPerStream     int32         `json:"max_upload_buffer_per_stream" yaml:"max_upload_buffer_per_stream" toml:"max_upload_buffer_per_stream"`             // flow control window of a stream
+}
+
+// HTTP3Server an http/3 (QUIC) server, ginx doesn't depend on any QUIC implementation,
+// wrap one (e.g. github.com/quic-go/quic-go/http3.Server) to serve http/3:
+//
+//	type quicServer struct{ s *http3.Server }
+//
+//	func (q *quicServer) Serve(conn net.PacketConn, cfg *tls.Config, h http.Handler) error {
+//	    q.s = &http3.Server{TLSConfig: http3.ConfigureTLSConfig(cfg), Handler: h}
+//	    return q.s.Serve(conn)
+//	}
+//
+//	func (q *quicServer) Shutdown(ctx context.Context) error { return q.s.Close() }
+type HTTP3Server interface {
+	// Serve serve http/3 on the udp connection with the tls config of server, it blocks until shutdown
+	Serve(conn net.PacketConn, cfg *tls.Config, h http.Handler) error
+	// Shutdown stop serving gracefully
+	Shutdown(ctx context.Context) error
+}
+
+// newHTTP2Server create the http/2 server by options
+func newHTTP2Server(opts *HTTP2Options) *http2.Server {
+	h2s := &http2.Server{}
+	if opts != nil {
+		h2s.MaxConcurrentStreams = opts.MaxConcurrentStreams
+		h2s.MaxReadFrameSize = opts.MaxReadFrameSize
+		h2s.IdleTimeout = opts.IdleTimeout
+		h2s.MaxUploadBufferPerConnection = opts.MaxUploadBufferPerConnection
+		h2s.MaxUploadBufferPerStream = opts.MaxUploadBufferPerStream
+	}
+	return h2s
+}
+
+// handler get the handler of server, the engine is wrapped to limit the body size, serve h2c
+// and advertise http/3 by options
+func (s *HTTPServer) handler() http.Handler {
+	opts := s.options
+	h := maxBodyHandler(s.engine, opts.MaxBodyBytes)
+	if opts.HTTP3Server != nil {
+		h = s.altSvcHandler(h)
+	}
+	if opts.H2C || opts.HTTP2 != nil {
+		s.h2s = newHTTP2Server(opts.HTTP2)
+	}
+	if opts.H2C {
+		h = h2c.NewHandler(h, s.h2s)
+	}
+	return h
+}
+
+// http3Port get the udp port of http/3
+func (s *HTTPServer) http3Port() int {
+	if s.options.HTTP3Port > 0 {
+		return s.options.HTTP3Port
+	}
+	return s.options.Port
+}
+
+// altSvcHandler advertise http/3 in the Alt-Svc header of https responses, the port is the one
+// actually bound, nothing is advertised if http/3 is not serving
+func (s *HTTPServer) altSvcHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if altSvc := s.altSvc.Load(); r.TLS != nil && altSvc != nil {
+			w.Header().Set("Alt-Svc", *altSvc)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// listenHTTP3 bind the udp connection of http/3, it does nothing if https or http/3 is not enabled,
+// or the connection has been inherited from the parent process
+func (s *HTTPServer) listenHTTP3() error {
+	if !s.options.Tls || s.options.HTTP3Server == nil || s.packetConn != nil {
+		return nil
+	}
+	pc, err := net.ListenPacket("udp", net.JoinHostPort(s.options.Host, strconv.Itoa(s.http3Port())))
+	if err != nil {
+		return err
+	}
+	s.setPacketConn(pc)
+	return nil
+}
+
+// setPacketConn set the udp connection of http/3 and advertise its port
+func (s *HTTPServer) setPacketConn(pc net.PacketConn) {
+	s.packetConn = pc
+	port := s.http3Port()
+	if addr, ok := pc.LocalAddr().(*net.UDPAddr); ok {
+		port = addr.Port
+	}
+	altSvc := fmt.Sprintf(`h3=":%d"; ma=86400`, port)
+	s.altSvc.Store(&altSvc)
+}
+
+// serveHTTP3 serve http/3 on the udp connection
+func (s *HTTPServer) serveHTTP3(pc net.PacketConn) error {
+	return s.options.HTTP3Server.Serve(pc, s.svr.TLSConfig.Clone(), s.svr.Handler)
+}
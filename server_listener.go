@@ -0,0 +1,179 @@
+package ginx
+
+import (
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/whencome/ginx/log"
+)
+
+// listenFdsStart the first file descriptor passed by systemd socket activation
+const listenFdsStart = 3
+
+// serverListener a listener served by the server
+type serverListener struct {
+	net.Listener
+	tls      bool // serve https
+	redirect bool // redirect to https instead of serving
+}
+
+// listen bind the listeners of server, the tls config is loaded for https server
+func (s *HTTPServer) listen() ([]*serverListener, error) {
+	opts := s.options
+	if err := s.setupTLS(); err != nil {
+		return nil, err
+	}
+	// listeners inherited from the parent process by graceful restart
+	inherited, pc, err := inheritedListeners()
+	if err != nil {
+		return nil, err
+	}
+	if pc != nil {
+		if opts.Tls && opts.HTTP3Server != nil {
+			s.setPacketConn(pc)
+		} else {
+			_ = pc.Close()
+		}
+	}
+	if len(inherited) > 0 {
+		if err = s.listenHTTP3(); err != nil {
+			closeListeners(inherited)
+			return nil, err
+		}
+		return inherited, nil
+	}
+	var lns []net.Listener
+	if opts.SocketActivation {
+		if lns, err = activationListeners(); err != nil {
+			return nil, err
+		}
+	}
+	if len(lns) == 0 {
+		var ln net.Listener
+		if opts.UnixSocket != "" {
+			ln, err = listenUnix(opts.UnixSocket, opts.UnixSocketMode)
+		} else {
+			ln, err = net.Listen("tcp", s.svr.Addr)
+		}
+		if err != nil {
+			return nil, err
+		}
+		lns = append(lns, ln)
+	}
+	listeners := make([]*serverListener, 0, len(lns)+1)
+	for _, ln := range lns {
+		listeners = append(listeners, &serverListener{Listener: ln, tls: opts.Tls})
+	}
+	if opts.Tls && opts.HTTPPort > 0 {
+		ln, err := net.Listen("tcp", net.JoinHostPort(opts.Host, strconv.Itoa(opts.HTTPPort)))
+		if err != nil {
+			closeListeners(listeners)
+			return nil, err
+		}
+		listeners = append(listeners, &serverListener{Listener: ln, redirect: opts.RedirectHTTP})
+	}
+	if err = s.listenHTTP3(); err != nil {
+		closeListeners(listeners)
+		return nil, err
+	}
+	return listeners, nil
+}
+
+// closeListeners close the listeners
+func closeListeners(lns []*serverListener) {
+	for _, ln := range lns {
+		_ = ln.Close()
+	}
+}
+
+// listenUnix listen on the unix domain socket, the stale socket file is removed before listening
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&fs.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err = os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode != 0 {
+		if err = os.Chmod(path, mode); err != nil {
+			_ = ln.Close()
+			return nil, err
+		}
+	}
+	return ln, nil
+}
+
+// activationListeners get the listeners passed by systemd socket activation, see sd_listen_fds(3),
+// it returns nothing if the process is not activated by socket
+func activationListeners() ([]net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	// the fds should not be inherited by child processes
+	_ = os.Unsetenv("LISTEN_PID")
+	_ = os.Unsetenv("LISTEN_FDS")
+	_ = os.Unsetenv("LISTEN_FDNAMES")
+	lns := make([]net.Listener, 0, n)
+	for fd := listenFdsStart; fd < listenFdsStart+n; fd++ {
+		f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		ln, err := net.FileListener(f)
+		// the listener holds a dup of the fd
+		_ = f.Close()
+		if err != nil {
+			for _, l := range lns {
+				_ = l.Close()
+			}
+			return nil, fmt.Errorf("inherit listener of fd %d failed: %w", fd, err)
+		}
+		lns = append(lns, ln)
+	}
+	log.Infof("inherited %d listeners by socket activation", len(lns))
+	return lns, nil
+}
+
+// newRedirectServer create the server which redirects plain http requests to https
+func (s *HTTPServer) newRedirectServer() *http.Server {
+	return &http.Server{
+		Handler:           http.HandlerFunc(s.redirectToHTTPS),
+		ReadTimeout:       s.svr.ReadTimeout,
+		ReadHeaderTimeout: s.svr.ReadHeaderTimeout,
+		WriteTimeout:      s.svr.WriteTimeout,
+		IdleTimeout:       s.svr.IdleTimeout,
+		MaxHeaderBytes:    s.svr.MaxHeaderBytes,
+	}
+}
+
+// redirectToHTTPS redirect the request to the https port of server
+func (s *HTTPServer) redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	if host == "" {
+		http.Error(w, "missing host", http.StatusBadRequest)
+		return
+	}
+	if s.options.Port != 443 {
+		host = net.JoinHostPort(host, strconv.Itoa(s.options.Port))
+	}
+	code := http.StatusMovedPermanently
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		code = http.StatusPermanentRedirect
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), code)
+}
@@ -0,0 +1,229 @@
+//go:build !windows
+
+package ginx
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/whencome/ginx/log"
+)
+
+// environment variables passed to the new process by graceful restart
+const (
+	envListenFds   = "GINX_LISTEN_FDS"   // number of inherited listeners, starting from fd 3
+	envListenRoles = "GINX_LISTEN_ROLES" // roles of inherited listeners, e.g. "https,redirect"
+	envReadyFd     = "GINX_READY_FD"     // fd of the pipe to notify readiness
+)
+
+// roles of inherited listeners
+const (
+	listenerRoleHTTP     = "http"
+	listenerRoleHTTPS    = "https"
+	listenerRoleRedirect = "redirect"
+	listenerRoleHTTP3    = "http3" // the udp connection of http/3
+)
+
+// restartSignals signals supported to restart
+var restartSignals = map[string]os.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+}
+
+// lookupSignal get the signal by name, e.g. "SIGHUP" or "HUP", nil is returned if not supported
+func lookupSignal(name string) os.Signal {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if name != "" && !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	return restartSignals[name]
+}
+
+// filer a listener or connection which can get its file descriptor, such as *net.TCPListener, *net.UnixListener
+// and *net.UDPConn
+type filer interface {
+	File() (*os.File, error)
+}
+
+// Restart start a new process of the same executable and arguments, which inherits the listeners and
+// serves on them. It returns after the new process is ready, then the current server should be stopped
+// to drain active connections, which is done by Wait.
+func (s *HTTPServer) Restart() error {
+	if !s.running || len(s.listeners) == 0 {
+		return errors.New("http server is not running")
+	}
+	files := make([]*os.File, 0, len(s.listeners)+1)
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	roles := make([]string, 0, len(s.listeners))
+	for _, ln := range s.listeners {
+		lf, ok := ln.Listener.(filer)
+		if !ok {
+			return fmt.Errorf("listener of %s can not be inherited", ln.Addr())
+		}
+		f, err := lf.File()
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+		switch {
+		case ln.redirect:
+			roles = append(roles, listenerRoleRedirect)
+		case ln.tls:
+			roles = append(roles, listenerRoleHTTPS)
+		default:
+			roles = append(roles, listenerRoleHTTP)
+		}
+	}
+	if s.packetConn != nil {
+		pf, ok := s.packetConn.(filer)
+		if !ok {
+			return fmt.Errorf("http/3 connection of %s can not be inherited", s.packetConn.LocalAddr())
+		}
+		f, err := pf.File()
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+		roles = append(roles, listenerRoleHTTP3)
+	}
+	// the new process writes to the pipe when it's ready
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer pr.Close()
+	files = append(files, pw)
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(os.Environ(),
+		envListenFds+"="+strconv.Itoa(len(roles)),
+		envListenRoles+"="+strings.Join(roles, ","),
+		envReadyFd+"="+strconv.Itoa(listenFdsStart+len(roles)),
+	)
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	// close the write end in current process, so that reading gets EOF if the new process exits
+	_ = pw.Close()
+	files = files[:len(files)-1]
+	log.Infof("started new process %d, waiting for it to be ready", cmd.Process.Pid)
+
+	ready := make(chan error, 1)
+	go func() {
+		b := make([]byte, 1)
+		if _, err := io.ReadFull(pr, b); err != nil {
+			ready <- errors.New("new process exited before ready")
+			return
+		}
+		ready <- nil
+	}()
+	timeout := s.options.RestartTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	select {
+	case err = <-ready:
+	case <-time.After(timeout):
+		err = fmt.Errorf("new process is not ready in %s", timeout)
+	}
+	if err != nil {
+		_ = cmd.Process.Kill()
+		go func() {
+			_ = cmd.Wait()
+		}()
+		return err
+	}
+	pid := cmd.Process.Pid
+	_ = cmd.Process.Release()
+	// the socket file is used by the new process, keep it when the listener is closed
+	for _, ln := range s.listeners {
+		if ul, ok := ln.Listener.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+	log.Infof("new process %d is ready", pid)
+	return nil
+}
+
+// inheritedListeners get the listeners and the udp connection of http/3 inherited from the parent process
+// by graceful restart
+func inheritedListeners() ([]*serverListener, net.PacketConn, error) {
+	n, err := strconv.Atoi(os.Getenv(envListenFds))
+	if err != nil || n <= 0 {
+		return nil, nil, nil
+	}
+	roles := strings.Split(os.Getenv(envListenRoles), ",")
+	// the fds should not be inherited again by child processes
+	_ = os.Unsetenv(envListenFds)
+	_ = os.Unsetenv(envListenRoles)
+	lns := make([]*serverListener, 0, n)
+	var pc net.PacketConn
+	for i := 0; i < n; i++ {
+		fd := listenFdsStart + i
+		role := ""
+		if i < len(roles) {
+			role = roles[i]
+		}
+		f := os.NewFile(uintptr(fd), "GINX_LISTEN_FD_"+strconv.Itoa(fd))
+		if role == listenerRoleHTTP3 {
+			pc, err = net.FilePacketConn(f)
+			_ = f.Close()
+			if err != nil {
+				closeListeners(lns)
+				return nil, nil, fmt.Errorf("inherit http/3 connection of fd %d failed: %w", fd, err)
+			}
+			continue
+		}
+		ln, err := net.FileListener(f)
+		_ = f.Close()
+		if err != nil {
+			closeListeners(lns)
+			if pc != nil {
+				_ = pc.Close()
+			}
+			return nil, nil, fmt.Errorf("inherit listener of fd %d failed: %w", fd, err)
+		}
+		lns = append(lns, &serverListener{
+			Listener: ln,
+			tls:      role == listenerRoleHTTPS,
+			redirect: role == listenerRoleRedirect,
+		})
+	}
+	log.Infof("inherited %d listeners from parent process", len(lns))
+	return lns, pc, nil
+}
+
+// notifyReady notify the parent process that the server is ready
+func notifyReady() {
+	fd, err := strconv.Atoi(os.Getenv(envReadyFd))
+	if err != nil || fd <= 0 {
+		return
+	}
+	_ = os.Unsetenv(envReadyFd)
+	f := os.NewFile(uintptr(fd), "GINX_READY_FD")
+	defer f.Close()
+	if _, err = f.Write([]byte{1}); err != nil {
+		log.Errorf("notify parent process failed: %s", err)
+	}
+}
@@ -0,0 +1,163 @@
+//go:build linux
+
+package ginx
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// envRestartHelper set to run TestRestartHelper as the server process of TestRestart
+const envRestartHelper = "GINX_TEST_RESTART_HELPER"
+
+// TestRestartHelper is not a real test, it's the server process re-executed by TestRestart,
+// the new process started by Restart runs it again with the inherited listener
+func TestRestartHelper(t *testing.T) {
+	if os.Getenv(envRestartHelper) != "1" {
+		t.Skip("helper process of TestRestart")
+	}
+	opts := DefaultServerOptions()
+	opts.Host = "127.0.0.1"
+	opts.Port = 0
+	opts.Mode = ModeTest
+	opts.RestartSignal = "SIGHUP"
+	opts.RestartTimeout = 10 * time.Second
+	s := NewServer(opts)
+	s.GinEngine().GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, strconv.Itoa(os.Getpid()))
+	})
+	if _, err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Printf("ADDR %s\n", s.Addr())
+	if err := s.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRestart starts a server process, sends the restart signal and checks that a new process
+// serves on the same listener, then the old process exits
+func TestRestart(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip restarting processes in short mode")
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRestartHelper$")
+	cmd.Env = append(os.Environ(), envRestartHelper+"=1")
+	cmd.Stderr = os.Stderr
+	// the pipe is shared by the new process, it's not closed by cmd.Wait like cmd.StdoutPipe,
+	// otherwise the new process would be killed by SIGPIPE when writing logs
+	stdout, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+	cmd.Stdout = w
+	err = cmd.Start()
+	_ = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+	}()
+
+	addr, err := readHelperAddr(stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// keep draining the output of both processes
+	go func() {
+		_, _ = io.Copy(io.Discard, stdout)
+	}()
+	client := &http.Client{
+		Timeout:   time.Second,
+		Transport: &http.Transport{DisableKeepAlives: true},
+	}
+	// stop the process serving on addr at last, it's the new process if restarted
+	defer func() {
+		if pid, err := getPid(client, addr); err == nil {
+			_ = syscall.Kill(pid, syscall.SIGTERM)
+		}
+	}()
+	pid, err := getPid(client, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pid != cmd.Process.Pid {
+		t.Fatalf("served by %d, want %d", pid, cmd.Process.Pid)
+	}
+
+	if err = cmd.Process.Signal(syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	// the old process exits after the new one is ready and connections are drained
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+	select {
+	case err = <-exited:
+		if err != nil {
+			t.Fatalf("old process exited with error: %s", err)
+		}
+	case <-time.After(20 * time.Second):
+		t.Fatal("old process didn't exit after restart")
+	}
+
+	newPid, err := getPid(client, addr)
+	if err != nil {
+		t.Fatalf("listener is not handed over: %s", err)
+	}
+	if newPid == pid {
+		t.Fatalf("still served by the old process %d", pid)
+	}
+}
+
+// readHelperAddr read the address printed by the helper process
+func readHelperAddr(r io.Reader) (string, error) {
+	lines := make(chan string, 1)
+	go func() {
+		sc := bufio.NewScanner(r)
+		for sc.Scan() {
+			if addr, ok := strings.CutPrefix(sc.Text(), "ADDR "); ok {
+				lines <- addr
+				return
+			}
+		}
+		close(lines)
+	}()
+	select {
+	case addr, ok := <-lines:
+		if !ok {
+			return "", fmt.Errorf("helper process exited before listening")
+		}
+		return addr, nil
+	case <-time.After(10 * time.Second):
+		return "", fmt.Errorf("helper process is not listening in time")
+	}
+}
+
+// getPid get the pid of the process serving on addr
+func getPid(client *http.Client, addr string) (int, error) {
+	resp, err := client.Get("http://" + addr + "/")
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(b))
+}
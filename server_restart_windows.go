@@ -0,0 +1,27 @@
+//go:build windows
+
+package ginx
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+// lookupSignal graceful restart is not supported on windows
+func lookupSignal(name string) os.Signal {
+	return nil
+}
+
+// Restart graceful restart is not supported on windows
+func (s *HTTPServer) Restart() error {
+	return errors.New("graceful restart is not supported on windows")
+}
+
+// inheritedListeners graceful restart is not supported on windows
+func inheritedListeners() ([]*serverListener, net.PacketConn, error) {
+	return nil, nil, nil
+}
+
+// notifyReady graceful restart is not supported on windows
+func notifyReady() {}
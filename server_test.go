@@ -0,0 +1,64 @@
+package ginx
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestStopTimedOut checks that the server is cleaned up and can't be stopped again when shutdown timed out
+// without closing active connections forcibly
+func TestStopTimedOut(t *testing.T) {
+	opts := DefaultServerOptions()
+	opts.Host = "127.0.0.1"
+	opts.Port = 0
+	opts.Mode = ModeTest
+	opts.ShutdownTimeout = 100 * time.Millisecond
+	opts.ForceClose = false
+	s := NewServer(opts)
+	hung := make(chan struct{})
+	defer close(hung)
+	entered := make(chan struct{})
+	s.GinEngine().GET("/hung", func(c *gin.Context) {
+		close(entered)
+		<-hung
+	})
+	postStopped := false
+	s.PostStop(func(r *gin.Engine) error {
+		postStopped = true
+		return nil
+	})
+	if _, err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		resp, err := http.Get("http://" + s.Addr() + "/hung")
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+	}()
+	select {
+	case <-entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request is not handled")
+	}
+
+	err := s.Stop()
+	if err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Fatalf("got %v, want shutdown timed out", err)
+	}
+	if !postStopped {
+		t.Fatal("post stop hooks are not run")
+	}
+	select {
+	case <-s.Done():
+	default:
+		t.Fatal("server is not done")
+	}
+	if err = s.Stop(); err == nil {
+		t.Fatal("stopped twice")
+	}
+}
@@ -0,0 +1,236 @@
+package ginx
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/whencome/ginx/log"
+	"golang.org/x/net/http2"
+)
+
+// tlsVersions supported tls versions by name
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// clientAuthTypes client authentication policies by name
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"none":               tls.NoClientCert,
+	"request":            tls.RequestClientCert,
+	"require":            tls.RequireAnyClientCert,
+	"verify_if_given":    tls.VerifyClientCertIfGiven,
+	"require_and_verify": tls.RequireAndVerifyClientCert,
+}
+
+// setupTLS build the tls config of https server by options, it does nothing if Tls is disabled
+func (s *HTTPServer) setupTLS() error {
+	if !s.options.Tls {
+		return nil
+	}
+	cfg, err := s.buildTLSConfig()
+	if err != nil {
+		return err
+	}
+	s.svr.TLSConfig = cfg
+	// use the tuned http/2 server instead of the default one of net/http
+	if s.options.HTTP2 != nil {
+		if err = http2.ConfigureServer(s.svr, s.h2s); err != nil {
+			return fmt.Errorf("configure http/2 failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// buildTLSConfig build tls config based on ServerOptions.TLSConfig
+func (s *HTTPServer) buildTLSConfig() (*tls.Config, error) {
+	opts := s.options
+	cfg := &tls.Config{}
+	if opts.TLSConfig != nil {
+		cfg = opts.TLSConfig.Clone()
+	}
+	if opts.TLSMinVersion != "" {
+		v, ok := tlsVersions[strings.TrimPrefix(strings.TrimPrefix(opts.TLSMinVersion, "tls"), "TLS")]
+		if !ok {
+			return nil, fmt.Errorf("unknown tls version %s", opts.TLSMinVersion)
+		}
+		// never lower the version set by TLSConfig explicitly
+		if v > cfg.MinVersion {
+			cfg.MinVersion = v
+		}
+	}
+	if len(opts.TLSCipherSuites) > 0 {
+		suites, err := cipherSuites(opts.TLSCipherSuites)
+		if err != nil {
+			return nil, err
+		}
+		cfg.CipherSuites = suites
+	}
+	if opts.ClientCAFile != "" {
+		pem, err := os.ReadFile(opts.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client CA failed: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", opts.ClientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if opts.ClientAuth != "" {
+		auth, ok := clientAuthTypes[opts.ClientAuth]
+		if !ok {
+			return nil, fmt.Errorf("unknown client auth %s", opts.ClientAuth)
+		}
+		cfg.ClientAuth = auth
+	}
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		r, err := newCertReloader(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if s.certReloader != nil {
+			s.certReloader.Close()
+		}
+		// the files are watched once serving started, so nothing is left running if listening failed
+		s.certReloader = r
+		cfg.Certificates = nil
+		cfg.GetCertificate = r.GetCertificate
+	}
+	if len(cfg.Certificates) == 0 && cfg.GetCertificate == nil && cfg.GetConfigForClient == nil {
+		return nil, errors.New("no certificate configured for https server")
+	}
+	return cfg, nil
+}
+
+// cipherSuites get the ids of cipher suites by names, insecure cipher suites are allowed if named explicitly
+func cipherSuites(names []string) ([]uint16, error) {
+	known := make(map[string]uint16)
+	for _, cs := range tls.CipherSuites() {
+		known[cs.Name] = cs.ID
+	}
+	for _, cs := range tls.InsecureCipherSuites() {
+		known[cs.Name] = cs.ID
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %s", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// ReloadCertificate load the certificate and key files again, new connections use the new certificate
+func (s *HTTPServer) ReloadCertificate() error {
+	if s.certReloader == nil {
+		return errors.New("no certificate file to reload")
+	}
+	return s.certReloader.reload()
+}
+
+// certReloader provide the certificate loaded from files, and reload it when the files changed
+type certReloader struct {
+	certFile string
+	keyFile  string
+	mutex    sync.RWMutex
+	cert     *tls.Certificate
+	modTime  time.Time
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// newCertReloader create a certificate reloader, the certificate is loaded immediately
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		stop:     make(chan struct{}),
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate get the current certificate, it's used as tls.Config.GetCertificate
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.cert, nil
+}
+
+// lastModTime get the latest modification time of certificate and key files
+func (r *certReloader) lastModTime() (time.Time, error) {
+	var t time.Time
+	for _, f := range []string{r.certFile, r.keyFile} {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return t, err
+		}
+		if fi.ModTime().After(t) {
+			t = fi.ModTime()
+		}
+	}
+	return t, nil
+}
+
+// reload load the certificate and key files
+func (r *certReloader) reload() error {
+	modTime, err := r.lastModTime()
+	if err != nil {
+		return fmt.Errorf("load certificate failed: %w", err)
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load certificate failed: %w", err)
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+// watch reload the certificate periodically if the files changed, the old certificate is kept if reloading failed
+func (r *certReloader) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			modTime, err := r.lastModTime()
+			r.mutex.RLock()
+			changed := err == nil && !modTime.Equal(r.modTime)
+			r.mutex.RUnlock()
+			if !changed {
+				continue
+			}
+			if err = r.reload(); err != nil {
+				log.Errorf("reload certificate failed: %s", err)
+				continue
+			}
+			log.Infof("certificate %s reloaded", r.certFile)
+		}
+	}
+}
+
+// Close stop watching the certificate files
+func (r *certReloader) Close() {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+}
@@ -55,6 +55,9 @@ func (r DefaultApiResponser) Response(c *gin.Context, code int, v interface{}) {
 }
 
 func (r DefaultApiResponser) Success(c *gin.Context, v interface{}) {
+	if pr, ok := v.(PagedResponse); ok {
+		SetPageLinks(c, pr)
+	}
 	c.JSON(http.StatusOK, v)
 	c.Abort()
 }
@@ -1,15 +1,64 @@
 package ginx
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"html/template"
+	"io"
+	"io/fs"
 	"net/http"
+	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/whencome/ginx/log"
 )
 
+// PageFuncBinder bind a template function to the page being rendered,
+// p will be nil when the template is parsed or rendered without a page
+type PageFuncBinder func(p *Page) interface{}
+
+var (
+	// pageFuncs template functions bound to the current page
+	pageFuncs   = make(map[string]PageFuncBinder)
+	pageFuncsMu sync.RWMutex
+	// pageFuncsGen increases when page functions changed, views drop templates cached before
+	pageFuncsGen atomic.Uint64
+)
+
+// RegisterPageFunc register a template function which is bound to the page being rendered.
+// It should be called before any template is rendered, templates cached by views are parsed
+// again if it's called later.
+func RegisterPageFunc(name string, f PageFuncBinder) {
+	if name == "" || f == nil {
+		return
+	}
+	pageFuncsMu.Lock()
+	pageFuncs[name] = f
+	pageFuncsMu.Unlock()
+	pageFuncsGen.Add(1)
+}
+
+// bindPageFuncs create template functions for the given page, it returns nil if no page functions registered
+func bindPageFuncs(p *Page) template.FuncMap {
+	pageFuncsMu.RLock()
+	defer pageFuncsMu.RUnlock()
+	if len(pageFuncs) == 0 {
+		return nil
+	}
+	m := template.FuncMap{}
+	for name, f := range pageFuncs {
+		m[name] = f(p)
+	}
+	return m
+}
+
 // ViewOption option for view
 type ViewOption func(*View)
 
@@ -31,28 +80,136 @@ func WithTplExtension(ext string) ViewOption {
 	}
 }
 
+// WithLayout set the default layout of pages, the layout is a template file relative to tplDir
+func WithLayout(l string) ViewOption {
+	return func(view *View) {
+		view.layout = l
+	}
+}
+
+// WithPartialsDir set the partials directory relative to tplDir, all templates
+// in the directory will be loaded automatically for every page
+func WithPartialsDir(d string) ViewOption {
+	return func(view *View) {
+		view.partialsDir = d
+	}
+}
+
+// WithDevMode enable or disable development mode, templates will be reloaded automatically when
+// changed in development mode. If not set, development mode is enabled when gin runs in debug mode.
+func WithDevMode(b bool) ViewOption {
+	return func(view *View) {
+		view.devMode = b
+		view.devModeSet = true
+	}
+}
+
+// WithReloadInterval set the interval of checking template changes in development mode
+func WithReloadInterval(d time.Duration) ViewOption {
+	return func(view *View) {
+		if d > 0 {
+			view.reloadInterval = d
+		}
+	}
+}
+
+// WithFS load templates from the given file system, such as embed.FS, tplDir is
+// relative to the root of the file system then
+func WithFS(fsys fs.FS) ViewOption {
+	return func(view *View) {
+		view.fsys = fsys
+	}
+}
+
+// WithLocale set the locale used by formatting functions, such as formatDate and formatNumber
+func WithLocale(l string) ViewOption {
+	return func(view *View) {
+		view.locale = l
+	}
+}
+
+// WithFuncs add custom template functions
+func WithFuncs(m template.FuncMap) ViewOption {
+	return func(view *View) {
+		view.AddFuncs(m)
+	}
+}
+
+// WithErrorTemplate set the template to show errors of the status code, code 0 sets the default
+// error template for all status codes. Without error templates, errors are shown in the page template.
+func WithErrorTemplate(code int, tpl string) ViewOption {
+	return func(view *View) {
+		view.errorTemplates[code] = tpl
+	}
+}
+
+// WithGzip compress the rendered output by gzip with the level (gzip.DefaultCompression, gzip.BestSpeed...)
+// if the client accepts it, small outputs are not compressed
+func WithGzip(level int) ViewOption {
+	return func(view *View) {
+		view.SetGzip(level)
+	}
+}
+
 type View struct {
 	// tplDir register template file path
 	tplDir string // "view"
+	// fsys file system to load templates from, nil means loading from disk
+	fsys fs.FS
+	// static assets served by the view
+	staticPath string
+	staticDir  string
 	// tplFiles register common template file list
 	tplFiles []string
 	// tplExtension define template file extension
 	tplExtension string // ".html"
+	// layout default layout of pages, empty means no layout
+	layout string
+	// partialsDir directory of partial templates which are loaded for every page
+	partialsDir string
+	// partials cached template files in partialsDir, nil means not scanned yet
+	partials      []string
+	partialsMutex sync.RWMutex
 	// funcMaps define custom function list
 	funcMaps template.FuncMap
+	// locale used by formatting functions
+	locale string
+	// use text/template instead of html/template
+	textTemplate bool
+	// Content-Type of rendered response
+	contentType string
+	// errorTemplates templates to show errors, keyed by status code
+	errorTemplates map[int]string
+	// gzip compression of rendered output
+	gzipEnabled bool
+	gzipLevel   int
+	gzipPool    sync.Pool
+	// content hash of static assets
+	assetHashes sync.Map
 	// template cache for better performance
-	templateCache map[string]*template.Template
+	templateCache map[string]templateSet
 	cacheMutex    sync.RWMutex
+	// generation of page functions which the cached templates were parsed with
+	pageFuncsGen atomic.Uint64
+	// development mode, watch template changes and invalidate cache
+	devMode        bool
+	devModeSet     bool
+	reloadInterval time.Duration
+	watcher        *viewWatcher
+	watchOnce      sync.Once
 }
 
 // NewView create a new view
 func NewView(options ...ViewOption) *View {
 	view := &View{
-		tplDir:        "view",
-		tplFiles:      make([]string, 0),
-		tplExtension:  ".html",
-		funcMaps:      template.FuncMap{},
-		templateCache: make(map[string]*template.Template),
+		tplDir:         "view",
+		tplFiles:       make([]string, 0),
+		tplExtension:   ".html",
+		funcMaps:       template.FuncMap{},
+		contentType:    "text/html; charset=utf-8",
+		templateCache:  make(map[string]templateSet),
+		errorTemplates: make(map[int]string),
+		reloadInterval: time.Second,
 	}
 	if len(options) > 0 {
 		for _, o := range options {
@@ -102,124 +259,435 @@ func (view *View) SetTplExtension(ext string) {
 	view.tplExtension = ext
 }
 
-// SetFuncMap set custom function list
+// SetFS set the file system to load templates from
+func (view *View) SetFS(fsys fs.FS) {
+	view.fsys = fsys
+}
+
+// SetLayout set the default layout of pages, empty means no layout
+func (view *View) SetLayout(l string) {
+	view.layout = l
+}
+
+// SetPartialsDir set the partials directory relative to tplDir
+func (view *View) SetPartialsDir(d string) {
+	view.partialsDir = d
+}
+
+// SetLocale set the locale used by formatting functions
+func (view *View) SetLocale(l string) {
+	view.locale = l
+}
+
+// SetFuncMap set custom function list, it replaces all custom functions, the built-in functions are kept
 func (view *View) SetFuncMap(m template.FuncMap) {
 	view.funcMaps = m
 }
 
-// calcTplFiles calculate all template files to load
-func (view *View) calcTplFiles(tpl string) []string {
+// AddFuncs add custom functions, functions with the same name will be replaced
+func (view *View) AddFuncs(m template.FuncMap) {
+	if view.funcMaps == nil {
+		view.funcMaps = template.FuncMap{}
+	}
+	for k, f := range m {
+		view.funcMaps[k] = f
+	}
+}
+
+// tplFile get the template file name with extension
+func (view *View) tplFile(f string) string {
+	f = strings.TrimPrefix(path.Clean(filepath.ToSlash(f)), "/")
+	if !strings.HasSuffix(f, view.tplExtension) {
+		f += view.tplExtension
+	}
+	return f
+}
+
+// tplName get the template name of a file, which is the file name without extension
+func (view *View) tplName(f string) string {
+	return strings.TrimSuffix(filepath.ToSlash(f), view.tplExtension)
+}
+
+// templateFS get the file system of templates, the root of which is tplDir
+func (view *View) templateFS() (fs.FS, error) {
+	if view.fsys == nil {
+		return os.DirFS(view.tplDir), nil
+	}
+	dir := path.Clean(filepath.ToSlash(view.tplDir))
+	if dir == "." || dir == "" {
+		return view.fsys, nil
+	}
+	return fs.Sub(view.fsys, dir)
+}
+
+// readTplFile read the content of template file, files on disk are joined with tplDir,
+// so that they can be outside tplDir such as "../shared/nav.html"
+func (view *View) readTplFile(f string) ([]byte, error) {
+	if view.fsys == nil {
+		return os.ReadFile(filepath.Join(view.tplDir, filepath.FromSlash(f)))
+	}
+	fsys, err := view.templateFS()
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(fsys, f)
+}
+
+// partialFiles list all template files in partials directory, the list is cached until the partials
+// change in development mode, or the cache is cleared or reloaded
+func (view *View) partialFiles() ([]string, error) {
+	view.partialsMutex.RLock()
+	files := view.partials
+	view.partialsMutex.RUnlock()
+	if files != nil {
+		return files, nil
+	}
+	files, err := view.scanPartials()
+	if err != nil {
+		return nil, err
+	}
+	view.partialsMutex.Lock()
+	view.partials = files
+	view.partialsMutex.Unlock()
+	return files, nil
+}
+
+// resetPartials drop the cached partial list, the partials directory is scanned again when rendering
+func (view *View) resetPartials() {
+	view.partialsMutex.Lock()
+	view.partials = nil
+	view.partialsMutex.Unlock()
+}
+
+// isPartial check whether the template file is in partials directory
+func (view *View) isPartial(f string) bool {
+	if view.partialsDir == "" {
+		return false
+	}
+	return strings.HasPrefix(f, path.Clean(filepath.ToSlash(view.partialsDir))+"/")
+}
+
+// scanPartials walk the partials directory to list all template files
+func (view *View) scanPartials() ([]string, error) {
+	files := make([]string, 0)
+	if view.partialsDir == "" {
+		return files, nil
+	}
+	root := path.Clean(filepath.ToSlash(view.partialsDir))
+	// the partials directory on disk is walked directly, it can be outside tplDir
+	fsys, dir := fs.FS(os.DirFS(filepath.Join(view.tplDir, filepath.FromSlash(root)))), "."
+	if view.fsys != nil {
+		tfs, err := view.templateFS()
+		if err != nil {
+			return nil, err
+		}
+		fsys, dir = tfs, root
+	}
+	err := fs.WalkDir(fsys, dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(p, view.tplExtension) {
+			return nil
+		}
+		if dir == "." {
+			p = path.Join(root, p)
+		}
+		files = append(files, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// calcTplFiles calculate all template files to load, the files are in order of
+// layout, partials, common files and the page, so that the page can override the blocks defined before
+func (view *View) calcTplFiles(tpl string, layout string) ([]string, error) {
 	tmpTplFiles := make([]string, 0)
-	tplFile := filepath.Join(view.tplDir, tpl)
-	if !strings.HasSuffix(tplFile, view.tplExtension) {
-		tplFile += view.tplExtension
+	if layout != "" {
+		tmpTplFiles = append(tmpTplFiles, view.tplFile(layout))
+	}
+	partials, err := view.partialFiles()
+	if err != nil {
+		return nil, err
 	}
-	tmpTplFiles = append(tmpTplFiles, tplFile)
+	tmpTplFiles = append(tmpTplFiles, partials...)
 	for _, tplFile := range view.tplFiles {
-		tplFile = filepath.Join(view.tplDir, tplFile)
-		if !strings.HasSuffix(tplFile, view.tplExtension) {
-			tplFile += view.tplExtension
+		tmpTplFiles = append(tmpTplFiles, view.tplFile(tplFile))
+	}
+	tmpTplFiles = append(tmpTplFiles, view.tplFile(tpl))
+	return tmpTplFiles, nil
+}
+
+// parseFiles parse template files into one template set, each file is named by its name without extension,
+// and by its base name like ParseFiles of html/template, the later file wins if base names are the same
+func (view *View) parseFiles(files []string) (templateSet, error) {
+	if len(files) == 0 {
+		return nil, errors.New("no template files to parse")
+	}
+	t := newTemplateSet(view.textTemplate)
+	t.Funcs(view.defaultFuncs())
+	if m := view.pageFuncs(nil); m != nil {
+		t.Funcs(m)
+	}
+	if len(view.funcMaps) > 0 {
+		t.Funcs(view.funcMaps)
+	}
+	for _, f := range files {
+		b, err := view.readTplFile(f)
+		if err != nil {
+			return nil, newTemplateError(f, err)
+		}
+		name := view.tplName(f)
+		if err = t.Parse(name, string(b)); err != nil {
+			return nil, newTemplateError(f, err)
+		}
+		if err = t.Alias(name, path.Base(filepath.ToSlash(f))); err != nil {
+			return nil, newTemplateError(f, err)
 		}
-		tmpTplFiles = append(tmpTplFiles, tplFile)
 	}
-	return tmpTplFiles
+	return newCachedTemplateSet(t), nil
 }
 
-// renderHtml render file with caching support
+// renderHtml render file to response with caching support, name is the template to execute.
+// The response is written only if rendering succeeded.
 func (view *View) renderHtml(w http.ResponseWriter, name string, files []string, v interface{}) error {
-	// set header
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf, err := view.renderBuffer(name, files, v)
+	if err != nil {
+		return err
+	}
+	defer putBuffer(buf)
+	return view.writeResponse(w, requestOf(v), buf.Bytes())
+}
+
+// render render file with caching support, name is the template to execute
+func (view *View) render(w io.Writer, name string, files []string, v interface{}) error {
+	buf, err := view.renderBuffer(name, files, v)
+	if err != nil {
+		return err
+	}
+	defer putBuffer(buf)
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// renderBuffer render file into a pooled buffer, the buffer should be released by putBuffer
+func (view *View) renderBuffer(name string, files []string, v interface{}) (*bytes.Buffer, error) {
+	t, err := view.template(files)
+	if err != nil {
+		return nil, err
+	}
+	buf := getBuffer()
+	if err = view.execute(buf, t, name, v); err != nil {
+		putBuffer(buf)
+		log.Errorf("template execute failed: %s", err)
+		return nil, err
+	}
+	return buf, nil
+}
+
+// template get the parsed template of files from cache, the files are parsed and cached if not found
+func (view *View) template(files []string) (templateSet, error) {
+	// watch template changes in development mode
+	view.watch()
+	view.checkPageFuncs()
 
 	// generate cache key
-	cacheKey := strings.Join(files, "|")
+	cacheKey := view.cacheKey(files)
 
 	// try to get from cache
 	view.cacheMutex.RLock()
-	if tmpl, ok := view.templateCache[cacheKey]; ok {
-		view.cacheMutex.RUnlock()
-		// execute cached template
-		err := tmpl.Execute(w, v)
-		if err != nil {
-			log.Errorf("template execute failed: %s", err)
-			return err
-		}
-		return nil
-	}
+	t, ok := view.templateCache[cacheKey]
 	view.cacheMutex.RUnlock()
+	if ok {
+		return t, nil
+	}
 
 	// parse template files
 	view.cacheMutex.Lock()
 	defer view.cacheMutex.Unlock()
 
 	// double check after acquiring write lock
-	if tmpl, ok := view.templateCache[cacheKey]; ok {
-		err := tmpl.Execute(w, v)
-		if err != nil {
-			log.Errorf("template execute failed: %s", err)
-			return err
-		}
-		return nil
+	if t, ok = view.templateCache[cacheKey]; ok {
+		return t, nil
 	}
 
-	t := template.New(name)
-	if len(view.funcMaps) > 0 {
-		t.Funcs(view.funcMaps)
-	}
-	t, err := t.ParseFiles(files...)
+	t, err := view.parseFiles(files)
 	if err != nil {
 		log.Errorf("parse template files failed: %s", err)
-		return err
+		return nil, err
 	}
 
 	// cache the template
 	view.templateCache[cacheKey] = t
+	return t, nil
+}
 
-	// output content
-	err = t.Execute(w, v)
+// pageFuncs bind page functions to the page, functions defined by the view explicitly take precedence:
+// custom functions added by AddFuncs, and formatting functions when the locale of view is set
+func (view *View) pageFuncs(p *Page) template.FuncMap {
+	m := bindPageFuncs(p)
+	for name := range m {
+		if _, ok := view.funcMaps[name]; ok {
+			delete(m, name)
+		} else if view.locale != "" && localeFuncNames[name] {
+			delete(m, name)
+		}
+	}
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+// checkPageFuncs drop the cached templates if page functions changed after they were parsed
+func (view *View) checkPageFuncs() {
+	if gen := pageFuncsGen.Load(); view.pageFuncsGen.Swap(gen) != gen {
+		view.ClearCache()
+	}
+}
+
+// execute execute the template, a cached template is executed by a copy of it,
+// and page functions are bound to the page being rendered
+func (view *View) execute(w io.Writer, t templateSet, name string, v interface{}) error {
+	// the template may be named by the name given or the file name without extension
+	if !t.Defined(name) {
+		name = view.tplName(name)
+	}
+	ct, ok := t.(*cachedTemplateSet)
+	if !ok {
+		return t.ExecuteTemplate(w, name, v)
+	}
+	et, err := ct.get()
+	if err != nil {
+		return err
+	}
+	defer ct.put(et)
+	p, _ := v.(*Page)
+	if m := view.pageFuncs(p); m != nil {
+		et.Funcs(m)
+	}
+	return et.ExecuteTemplate(w, name, v)
+}
+
+// Execute render file with the default layout to any writer, e.g. to build the content of an email
+func (view *View) Execute(w io.Writer, f string, v interface{}) error {
+	name, tmpTplFiles, err := view.resolve(f, view.layout)
 	if err != nil {
-		log.Errorf("template execute failed: %s", err)
 		return err
 	}
-	return nil
+	return view.render(w, name, tmpTplFiles, v)
 }
 
-// Render render file
+// resolve get the template to execute and the files to load, the layout is executed if not empty
+func (view *View) resolve(f string, layout string) (string, []string, error) {
+	tmpTplFiles, err := view.calcTplFiles(f, layout)
+	if err != nil {
+		log.Errorf("calculate template files failed: %s", err)
+		return "", nil, err
+	}
+	name := f
+	if layout != "" {
+		name = view.tplName(layout)
+	}
+	return name, tmpTplFiles, nil
+}
+
+// Render render file with the default layout
 func (view *View) Render(w http.ResponseWriter, f string, v interface{}) error {
-	tmpTplFiles := view.calcTplFiles(f)
+	return view.renderWithLayout(w, f, view.layout, v)
+}
+
+// renderWithLayout render file with the given layout, the layout will be executed instead of the file if not empty
+func (view *View) renderWithLayout(w http.ResponseWriter, f string, layout string, v interface{}) error {
+	name, tmpTplFiles, err := view.resolve(f, layout)
+	if err != nil {
+		return err
+	}
 	// render html
-	return view.renderHtml(w, f, tmpTplFiles, v)
+	return view.renderHtml(w, name, tmpTplFiles, v)
 }
 
-// RenderDirect directly render specified file
+// RenderDirect directly render specified file, no layout and common files will be loaded
 func (view *View) RenderDirect(w http.ResponseWriter, name string, files []string, v interface{}) error {
 	tmpTplFiles := make([]string, 0)
 	for _, tplFile := range files {
-		tplFile = filepath.Join(view.tplDir, tplFile)
-		if !strings.HasSuffix(tplFile, view.tplExtension) {
-			tplFile += view.tplExtension
-		}
-		tmpTplFiles = append(tmpTplFiles, tplFile)
+		tmpTplFiles = append(tmpTplFiles, view.tplFile(tplFile))
 	}
 	return view.renderHtml(w, name, tmpTplFiles, v)
 }
 
-// RenderPage render page based on Page info
+// pageLayout get the layout of page, the page layout overrides the default layout
+func (view *View) pageLayout(p *Page) string {
+	if p.layoutSet {
+		return p.layout
+	}
+	return view.layout
+}
+
+// SetErrorTemplate set the template to show errors of the status code, code 0 sets the default error template
+func (view *View) SetErrorTemplate(code int, tpl string) {
+	view.errorTemplates[code] = tpl
+}
+
+// errorTemplate get the error template of status code, the default error template is used if not configured
+func (view *View) errorTemplate(code int) string {
+	if tpl, ok := view.errorTemplates[code]; ok {
+		return tpl
+	}
+	return view.errorTemplates[0]
+}
+
+// RenderPage render page based on Page info, the error template is rendered instead
+// if the page has errors and an error template of the status is configured
 func (view *View) RenderPage(w http.ResponseWriter, p *Page) error {
-	tmpTplFiles := view.calcTplFiles(p.Tpl)
-	// render html
-	return view.renderHtml(w, p.Tpl, tmpTplFiles, p)
+	tpl := p.Tpl
+	if p.HasError() && p.Status >= http.StatusBadRequest {
+		if et := view.errorTemplate(p.Status); et != "" {
+			tpl = et
+		}
+	}
+	if fragment := p.Fragment(); fragment != "" {
+		return view.renderFragments(w, tpl, append([]string{fragment}, p.oobFragments...), p)
+	}
+	return view.renderWithLayout(w, tpl, view.pageLayout(p), p)
 }
 
-// Show render page based on Page info
-func (view *View) Show(w http.ResponseWriter, p *Page) {
-	err := view.RenderPage(w, p)
+// renderFragments render the blocks of file without layout to response, the whole file is rendered
+// if the first block is not defined, e.g. a page without layout
+func (view *View) renderFragments(w http.ResponseWriter, f string, blocks []string, v interface{}) error {
+	files, err := view.calcTplFiles(f, "")
 	if err != nil {
-		p.AddError(err)
-		err = view.RenderPage(w, p)
-		if err != nil {
-			log.Errorf("render page failed: %s", err)
+		log.Errorf("calculate template files failed: %s", err)
+		return err
+	}
+	t, err := view.template(files)
+	if err != nil {
+		return err
+	}
+	buf := getBuffer()
+	defer putBuffer(buf)
+	for i, block := range blocks {
+		if !t.Defined(block) {
+			if i > 0 {
+				return fmt.Errorf("fragment %s is not defined", block)
+			}
+			block = f
+		}
+		if err = view.execute(buf, t, block, v); err != nil {
+			log.Errorf("template execute failed: %s", err)
+			return err
 		}
 	}
+	return view.writeResponse(w, requestOf(v), buf.Bytes())
+}
+
+// Show render page based on Page info, the error page or a plain text error is shown if rendering failed
+func (view *View) Show(w http.ResponseWriter, p *Page) {
+	_ = showPage(w, view, p)
 }
 
 // ShowDirect render page based on Page info directly
@@ -0,0 +1,129 @@
+package ginx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// gzipMinLength outputs shorter than it are not compressed
+	gzipMinLength = 1024
+	// maxPooledBufferSize buffers larger than it are not put back to the pool, to avoid holding too much memory
+	maxPooledBufferSize = 1 << 20
+)
+
+// bufferPool pool of buffers to render templates into
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// getBuffer get an empty buffer from pool
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// putBuffer put the buffer back to pool
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	bufferPool.Put(buf)
+}
+
+// requestOf get the request of the data being rendered, it's nil if the data is not a page
+func requestOf(v interface{}) *http.Request {
+	if p, ok := v.(*Page); ok && p != nil && p.Ctx != nil {
+		return p.Ctx.Request
+	}
+	return nil
+}
+
+// acceptsGzip check if the client accepts gzip encoding
+func acceptsGzip(r *http.Request) bool {
+	if r == nil {
+		return false
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		params := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		accepted := true
+		for _, param := range params[1:] {
+			param = strings.ReplaceAll(param, " ", "")
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				accepted = err == nil && q > 0
+			}
+		}
+		return accepted
+	}
+	return false
+}
+
+// SetGzip enable gzip compression of rendered output with the level, an invalid level means the default compression
+func (view *View) SetGzip(level int) {
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		level = gzip.DefaultCompression
+	}
+	view.gzipEnabled = true
+	view.gzipLevel = level
+	view.gzipPool = sync.Pool{}
+}
+
+// compress compress b by gzip into a pooled buffer, the buffer should be released by putBuffer
+func (view *View) compress(b []byte) (*bytes.Buffer, error) {
+	buf := getBuffer()
+	zw, ok := view.gzipPool.Get().(*gzip.Writer)
+	if ok {
+		zw.Reset(buf)
+	} else {
+		var err error
+		if zw, err = gzip.NewWriterLevel(buf, view.gzipLevel); err != nil {
+			putBuffer(buf)
+			return nil, err
+		}
+	}
+	defer view.gzipPool.Put(zw)
+	if _, err := zw.Write(b); err != nil {
+		putBuffer(buf)
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		putBuffer(buf)
+		return nil, err
+	}
+	return buf, nil
+}
+
+// writeResponse write the rendered output to response with Content-Type and Content-Length,
+// the output is compressed if gzip is enabled and accepted by the client
+func (view *View) writeResponse(w http.ResponseWriter, r *http.Request, b []byte) error {
+	h := w.Header()
+	h.Set("Content-Type", view.contentType)
+	if view.gzipEnabled {
+		addVary(h, "Accept-Encoding")
+		// skip if the response is already encoded, e.g. by a gzip middleware
+		if len(b) >= gzipMinLength && h.Get("Content-Encoding") == "" && acceptsGzip(r) {
+			buf, err := view.compress(b)
+			if err != nil {
+				return err
+			}
+			defer putBuffer(buf)
+			h.Set("Content-Encoding", "gzip")
+			b = buf.Bytes()
+		}
+	}
+	h.Set("Content-Length", strconv.Itoa(len(b)))
+	_, err := w.Write(b)
+	return err
+}
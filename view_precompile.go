@@ -0,0 +1,138 @@
+package ginx
+
+import (
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// templateLineRegexp match the line number in template parse error, e.g. "template: test/test:12: ..."
+var templateLineRegexp = regexp.MustCompile(`^template: [^:]*:(\d+):`)
+
+// TemplateError an error occurred when loading or parsing a template file
+type TemplateError struct {
+	File string // template file relative to tplDir
+	Line int    // line number, 0 if unknown
+	Err  error
+}
+
+// newTemplateError create a template error, the line number is extracted from the parse error
+func newTemplateError(f string, err error) *TemplateError {
+	te := &TemplateError{
+		File: f,
+		Err:  err,
+	}
+	if m := templateLineRegexp.FindStringSubmatch(err.Error()); len(m) == 2 {
+		te.Line, _ = strconv.Atoi(m[1])
+	}
+	return te
+}
+
+func (e *TemplateError) Error() string {
+	if e.Line > 0 {
+		msg := templateLineRegexp.ReplaceAllString(e.Err.Error(), "")
+		return e.File + ":" + strconv.Itoa(e.Line) + ":" + msg
+	}
+	return e.File + ": " + e.Err.Error()
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// TemplateErrors a list of template errors
+type TemplateErrors []*TemplateError
+
+func (es TemplateErrors) Error() string {
+	msgs := make([]string, 0, len(es))
+	for _, e := range es {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// pageFiles list all page templates in tplDir, layouts, partials and common files are excluded
+func (view *View) pageFiles() ([]string, error) {
+	fsys, err := view.templateFS()
+	if err != nil {
+		return nil, err
+	}
+	excludes := make(map[string]bool)
+	if view.layout != "" {
+		excludes[view.tplFile(view.layout)] = true
+	}
+	for _, f := range view.tplFiles {
+		excludes[view.tplFile(f)] = true
+	}
+	partialsDir := ""
+	if view.partialsDir != "" {
+		partialsDir = path.Clean(filepath.ToSlash(view.partialsDir)) + "/"
+	}
+	files := make([]string, 0)
+	err = fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(p, view.tplExtension) || excludes[p] {
+			return nil
+		}
+		if partialsDir != "" && strings.HasPrefix(p, partialsDir) {
+			return nil
+		}
+		files = append(files, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Precompile parse every page in tplDir together with the default layout, partials and common files,
+// and fill the template cache. All errors are reported at once as TemplateErrors, so that
+// template syntax errors can be found at startup instead of the first time a page is visited.
+// Pages rendered with other layouts are still parsed when first rendered.
+func (view *View) Precompile() error {
+	view.checkPageFuncs()
+	pages, err := view.pageFiles()
+	if err != nil {
+		return err
+	}
+	errs := make(TemplateErrors, 0)
+	reported := make(map[string]bool)
+	cache := make(map[string]templateSet)
+	for _, page := range pages {
+		files, err := view.calcTplFiles(page, view.layout)
+		if err != nil {
+			return err
+		}
+		t, err := view.parseFiles(files)
+		if err != nil {
+			te, ok := err.(*TemplateError)
+			if !ok {
+				te = newTemplateError(page, err)
+			}
+			// the error of a shared file is reported only once
+			if !reported[te.Error()] {
+				reported[te.Error()] = true
+				errs = append(errs, te)
+			}
+			continue
+		}
+		cache[view.cacheKey(files)] = t
+	}
+	view.cacheMutex.Lock()
+	for k, t := range cache {
+		view.templateCache[k] = t
+	}
+	view.cacheMutex.Unlock()
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
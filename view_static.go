@@ -0,0 +1,70 @@
+package ginx
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StaticFS get a http.FileSystem of static assets in dir. When the view loads templates from
+// a file system, dir is relative to the root of it, otherwise dir is a directory on disk.
+// Directory listing is disabled. A leading "/" of dir is ignored for the file system, and opening
+// any file fails if dir is invalid.
+func (view *View) StaticFS(dir string) http.FileSystem {
+	if view.fsys == nil {
+		return gin.Dir(dir, false)
+	}
+	dir = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(dir)), "/")
+	if dir == "" {
+		dir = "."
+	}
+	sub, err := fs.Sub(view.fsys, dir)
+	if err != nil {
+		return errFileSystem{err: fmt.Errorf("invalid static directory %q: %w", dir, err)}
+	}
+	return onlyFilesFS{fs: http.FS(sub)}
+}
+
+// errFileSystem a http.FileSystem which fails to open any file, it's used when the directory is invalid
+type errFileSystem struct {
+	err error
+}
+
+func (e errFileSystem) Open(name string) (http.File, error) {
+	return nil, e.err
+}
+
+// Static serve static assets in dir under the relativePath, e.g. view.Static(r, "/static", "static")
+func (view *View) Static(r gin.IRoutes, relativePath, dir string) gin.IRoutes {
+	view.staticPath = relativePath
+	view.staticDir = dir
+	return r.StaticFS(relativePath, view.StaticFS(dir))
+}
+
+// onlyFilesFS a http.FileSystem which disables directory listing
+type onlyFilesFS struct {
+	fs http.FileSystem
+}
+
+func (o onlyFilesFS) Open(name string) (http.File, error) {
+	f, err := o.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return neuteredReaddirFile{f}, nil
+}
+
+// neuteredReaddirFile a http.File which returns nothing when reading directory
+type neuteredReaddirFile struct {
+	http.File
+}
+
+func (f neuteredReaddirFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, nil
+}
@@ -0,0 +1,80 @@
+package ginx
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+// writeTplFiles write template files into dir, keyed by the path relative to dir
+func writeTplFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		f := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(f), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(f, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestViewPartialBaseName checks that partials are included by their path without extension,
+// and by their base name like templates parsed by ParseFiles
+func TestViewPartialBaseName(t *testing.T) {
+	dir := t.TempDir()
+	writeTplFiles(t, dir, map[string]string{
+		"partials/navbar.html": `<nav>{{ . }}</nav>`,
+		"pages/path.html":      `{{ template "partials/navbar" . }}`,
+		"pages/base.html":      `{{ template "navbar.html" . }}`,
+	})
+	view := NewView(WithTplDir(dir), WithPartialsDir("partials"))
+	for _, page := range []string{"pages/path", "pages/base"} {
+		var buf bytes.Buffer
+		if err := view.Execute(&buf, page, "NAV"); err != nil {
+			t.Fatalf("%s: %s", page, err)
+		}
+		if got := buf.String(); got != "<nav>NAV</nav>" {
+			t.Fatalf("%s: got %q", page, got)
+		}
+	}
+}
+
+// TestViewFilesOutsideTplDir checks that common files, layouts and partials on disk can be outside tplDir
+func TestViewFilesOutsideTplDir(t *testing.T) {
+	dir := t.TempDir()
+	writeTplFiles(t, dir, map[string]string{
+		"shared/nav.html":       `NAV`,
+		"shared/layout.html":    `[{{ template "content" . }}]`,
+		"partials/footer.html":  `{{ define "footer" }}FOOTER{{ end }}`,
+		"view/pages/index.html": `{{ define "content" }}{{ template "nav.html" . }} {{ template "footer" . }}{{ end }}`,
+	})
+	view := NewView(
+		WithTplDir(filepath.Join(dir, "view")),
+		WithTplFiles("../shared/nav"),
+		WithLayout("../shared/layout"),
+		WithPartialsDir("../partials"),
+	)
+	var buf bytes.Buffer
+	if err := view.Execute(&buf, "pages/index", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "[NAV FOOTER]" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+// TestViewStaticFS checks that the static directory of a file system can be written with a leading slash
+func TestViewStaticFS(t *testing.T) {
+	view := NewView(WithFS(fstest.MapFS{
+		"static/app.css": &fstest.MapFile{Data: []byte("body{}")},
+	}))
+	f, err := view.StaticFS("/static").Open("/app.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+}
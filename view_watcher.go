@@ -0,0 +1,181 @@
+package ginx
+
+import (
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/whencome/ginx/log"
+)
+
+// cacheKeySeparator separator of template files in cache key
+const cacheKeySeparator = "|"
+
+// tplFileStat the state of a template file, used to detect changes
+type tplFileStat struct {
+	modTime time.Time
+	size    int64
+}
+
+// viewWatcher watch template changes by polling the template directory
+type viewWatcher struct {
+	view  *View
+	stats map[string]tplFileStat
+	stop  chan struct{}
+}
+
+// cacheKey generate cache key by template files
+func (view *View) cacheKey(files []string) string {
+	return strings.Join(files, cacheKeySeparator)
+}
+
+// isDevMode check whether the view is running in development mode
+func (view *View) isDevMode() bool {
+	if view.devModeSet {
+		return view.devMode
+	}
+	return gin.IsDebugging()
+}
+
+// watch start watching template changes in development mode, it's safe to call multiple times
+func (view *View) watch() {
+	view.watchOnce.Do(func() {
+		if !view.isDevMode() {
+			return
+		}
+		w := &viewWatcher{
+			view: view,
+			stop: make(chan struct{}),
+		}
+		w.stats = w.scan()
+		view.watcher = w
+		go w.run(view.reloadInterval)
+		log.Debugf("watching template changes in %s", view.tplDir)
+	})
+}
+
+// Close stop watching template changes
+func (view *View) Close() {
+	// prevent starting watcher after closed
+	view.watchOnce.Do(func() {})
+	if view.watcher != nil {
+		close(view.watcher.stop)
+		view.watcher = nil
+	}
+}
+
+// ClearCache remove all cached templates, templates will be parsed again when rendering
+func (view *View) ClearCache() {
+	view.resetPartials()
+	view.cacheMutex.Lock()
+	defer view.cacheMutex.Unlock()
+	view.templateCache = make(map[string]templateSet)
+	view.assetHashes.Range(func(k, _ interface{}) bool {
+		view.assetHashes.Delete(k)
+		return true
+	})
+}
+
+// Reload parse all cached templates again and replace the cache, the cache keeps
+// unchanged if any template fails to parse, so it's safe to call after templates deployed
+func (view *View) Reload() error {
+	view.resetPartials()
+	view.cacheMutex.Lock()
+	defer view.cacheMutex.Unlock()
+	cache := make(map[string]templateSet)
+	for key := range view.templateCache {
+		t, err := view.parseFiles(strings.Split(key, cacheKeySeparator))
+		if err != nil {
+			return err
+		}
+		cache[key] = t
+	}
+	view.templateCache = cache
+	view.assetHashes.Range(func(k, _ interface{}) bool {
+		view.assetHashes.Delete(k)
+		return true
+	})
+	return nil
+}
+
+// invalidate remove cached templates which contain any of the given files
+func (view *View) invalidate(files []string) {
+	if len(files) == 0 {
+		return
+	}
+	changed := make(map[string]bool)
+	for _, f := range files {
+		changed[f] = true
+		// partials may be added or removed, all pages load them
+		if view.isPartial(f) {
+			view.resetPartials()
+		}
+	}
+	view.cacheMutex.Lock()
+	defer view.cacheMutex.Unlock()
+	for key := range view.templateCache {
+		for _, f := range strings.Split(key, cacheKeySeparator) {
+			if changed[f] {
+				delete(view.templateCache, key)
+				break
+			}
+		}
+	}
+}
+
+// run check template changes periodically until stopped
+func (w *viewWatcher) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+// scan collect the state of all template files
+func (w *viewWatcher) scan() map[string]tplFileStat {
+	stats := make(map[string]tplFileStat)
+	fsys, err := w.view.templateFS()
+	if err != nil {
+		return stats
+	}
+	_ = fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(p, w.view.tplExtension) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		stats[p] = tplFileStat{modTime: info.ModTime(), size: info.Size()}
+		return nil
+	})
+	return stats
+}
+
+// check compare the state of template files and invalidate the changed ones
+func (w *viewWatcher) check() {
+	stats := w.scan()
+	changed := make([]string, 0)
+	for f, st := range stats {
+		if old, ok := w.stats[f]; !ok || !old.modTime.Equal(st.modTime) || old.size != st.size {
+			changed = append(changed, f)
+		}
+	}
+	for f := range w.stats {
+		if _, ok := stats[f]; !ok {
+			changed = append(changed, f)
+		}
+	}
+	w.stats = stats
+	if len(changed) > 0 {
+		log.Debugf("template changed: %s", strings.Join(changed, ", "))
+		w.view.invalidate(changed)
+	}
+}